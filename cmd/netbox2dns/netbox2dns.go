@@ -2,11 +2,19 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	log "github.com/golang/glog"
+	"github.com/miekg/dns"
 	nb "github.com/scottlaird/netbox2dns"
 	"github.com/scottlaird/netbox2dns/netboxlib"
 )
@@ -16,27 +24,40 @@ var (
 )
 
 func usage() {
-	fmt.Printf("Usage: netbox2dns [--config=FILE] push\n")
+	fmt.Printf("Usage: netbox2dns [--config=FILE] COMMAND [ARGS]\n")
+	fmt.Printf("\n")
+	fmt.Printf("Commands:\n")
+	fmt.Printf("  push [--report=FILE] [--zone=PATTERN ...]\n")
+	fmt.Printf("                        Write zone files from NetBox data\n")
+	fmt.Printf("  serve                 Run as a daemon, syncing periodically\n")
+	fmt.Printf("  serve-dns             Run as a daemon, answering DNS queries from memory\n")
+	fmt.Printf("  validate              Check the config file for problems\n")
+	fmt.Printf("  explain NAME|IP       Show how NetBox data for a name or IP becomes DNS records\n")
+	fmt.Printf("  lint [--format=json]  Check NetBox IP address data for DNS problems\n")
+	fmt.Printf("  rollback --zone=ZONE [--to=TIMESTAMP | --list]\n")
+	fmt.Printf("                        Restore a zone file from a backup\n")
 	os.Exit(1)
 }
 
+// noArgs exits with a usage message if a command that doesn't take
+// arguments was given some.
+func noArgs(args []string) {
+	if len(args) != 0 {
+		usage()
+	}
+}
+
 func main() {
 	flag.Parse()
 	args := flag.Args()
 
-	if len(args) != 1 {
-		usage()
-	}
-
-	switch args[0] {
-	case "push":
-	default:
+	if len(args) < 1 {
 		usage()
 	}
 
 	var err error
 
-	// Load config file
+	// Find config file
 	file := *config
 	if file == "" {
 		file, err = nb.FindConfig("netbox2dns")
@@ -44,51 +65,399 @@ func main() {
 			log.Fatal(err)
 		}
 	}
+
+	switch args[0] {
+	case "push":
+		push(file, args[1:])
+	case "serve":
+		noArgs(args[1:])
+		serve(file)
+	case "serve-dns":
+		noArgs(args[1:])
+		serveDNS(file)
+	case "validate", "check-config":
+		noArgs(args[1:])
+		os.Exit(validate(file))
+	case "explain":
+		if len(args) != 2 {
+			usage()
+		}
+		explain(file, args[1])
+	case "lint":
+		os.Exit(lint(file, args[1:]))
+	case "rollback":
+		os.Exit(rollback(file, args[1:]))
+	default:
+		usage()
+	}
+}
+
+// validate checks the config file and prints every problem found.
+// It returns the exit code for the process.
+func validate(file string) int {
+	problems, _ := nb.CheckConfig(file)
+
+	errors := 0
+	warnings := 0
+	for _, p := range problems {
+		fmt.Println(p)
+		if p.Warning {
+			warnings++
+		} else {
+			errors++
+		}
+	}
+
+	if errors > 0 {
+		fmt.Printf("%s: %d error(s), %d warning(s)\n", file, errors, warnings)
+		return 1
+	}
+	fmt.Printf("%s: OK, %d warning(s)\n", file, warnings)
+	return 0
+}
+
+// stringList is a flag.Value that collects every use of a repeated
+// flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// push writes every zone once.  With --report, a JSON summary of the
+// run is written to a file, or to stdout if the filename is "-".
+// With --zone, only zones matching the given names or glob patterns
+// are written.
+func push(file string, args []string) {
+	var zonePatterns stringList
+	fs := flag.NewFlagSet("push", flag.ExitOnError)
+	reportFile := fs.String("report", "", "Write a JSON run report to this file, or \"-\" for stdout")
+	fs.Var(&zonePatterns, "zone", "Only write zones matching this name or glob pattern; may be repeated")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		usage()
+	}
+
 	cfg, err := nb.ParseConfig(file)
 	if err != nil {
-		log.Fatalf("Failed to parse config: %v")
+		log.Fatalf("Failed to parse config: %v", err)
 	}
 	log.Infof("Config read: %+v", cfg)
 
+	opts := nb.SyncOptions{}
+	if len(zonePatterns) > 0 {
+		opts.Zones, err = nb.SelectZones(cfg, zonePatterns)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Writing only zones %v", opts.Zones)
+	}
+
 	ctx := context.Background()
 
-	// Create new zones using data from Netbox
-	newZones := nb.NewZones()
-	for _, cz := range cfg.ZoneMap {
-		newZones.NewZone(cz)
+	result, err := nb.Sync(ctx, cfg, opts)
+	if *reportFile != "-" {
+		fmt.Printf("Found %d IP Addresses in %d zones\n", result.Addresses, len(cfg.ZoneMap)+len(result.Discovered))
+		if result.GitCommit != "" {
+			fmt.Printf("Committed changed zone files as %s\n", result.GitCommit)
+		}
+	}
+
+	if *reportFile != "" {
+		if reportErr := writeReport(*reportFile, nb.NewReport(cfg, result, err)); reportErr != nil {
+			log.Errorf("Failed to write report: %v", reportErr)
+		}
+	}
+
+	if cfg.Metrics.Textfile != "" {
+		metrics := nb.NewMetrics()
+		metrics.Observe(result, err)
+		if err := metrics.WriteTextfile(cfg.Metrics.Textfile); err != nil {
+			log.Errorf("Failed to write metrics to %q: %v", cfg.Metrics.Textfile, err)
+		}
+	}
+
+	if err != nil {
+		log.Fatalf("Push failed: %v", err)
+	}
+
+	log.Infof("Wrote %d zones", result.Zones)
+}
+
+// rollback restores a zone file from a backup, the newest one unless
+// --to gives a timestamp, and runs the zone's on_change hooks.  With
+// --list, it lists the zone's backups instead.  It returns the exit
+// code for the process.
+func rollback(file string, args []string) int {
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	zone := fs.String("zone", "", "Zone to restore")
+	to := fs.String("to", "", "Timestamp of the backup to restore, like 20240102T030405Z; defaults to the newest")
+	list := fs.Bool("list", false, "List the zone's backups instead of restoring one")
+	fs.Parse(args)
+	if fs.NArg() != 0 || *zone == "" || (*list && *to != "") {
+		usage()
+	}
+
+	cfg, err := nb.ParseConfig(file)
+	if err != nil {
+		log.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if *list {
+		backups, err := nb.ListBackups(cfg, *zone)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(backups) == 0 {
+			fmt.Printf("No backups of %s\n", *zone)
+		}
+		for _, b := range backups {
+			fmt.Printf("%s  %s\n", b.Timestamp, b.Path)
+		}
+		return 0
+	}
+
+	result, err := nb.Rollback(context.Background(), cfg, *zone, *to)
+	if result == nil {
+		log.Fatalf("Rollback failed: %v", err)
+	}
+	fmt.Printf("Restored %s from %s: %d record(s) added, %d removed\n", *zone, result.Backup.Timestamp, result.Changes.Added, result.Changes.Removed)
+	if result.GitCommit != "" {
+		fmt.Printf("Committed restored zone file as %s\n", result.GitCommit)
+	}
+
+	status := 0
+	if err != nil {
+		fmt.Println(err)
+		status = 1
+	}
+	for _, h := range result.Hooks {
+		if h.Err != nil {
+			fmt.Printf("on_change hook %q failed: %v\n%s\n", h.Command, h.Err, h.Output)
+			status = 1
+		}
+	}
+	for _, n := range result.Notifies {
+		if n.Err != nil {
+			fmt.Printf("NOTIFY to %s failed: %v\n", n.Target, n.Err)
+		} else {
+			fmt.Printf("Sent NOTIFY to %s: %s\n", n.Target, n.Rcode)
+		}
+	}
+	return status
+}
+
+// explain fetches the NetBox IP addresses matching a name or IP and
+// shows how each one is turned into DNS records.
+func explain(file, target string) {
+	cfg, err := nb.ParseConfig(file)
+	if err != nil {
+		log.Fatalf("Failed to parse config: %v", err)
+	}
+
+	netboxClient := netboxlib.NewClient(cfg.Netbox.Host, cfg.Netbox.Token)
+	zoneMap, _, err := nb.DiscoverZones(cfg, netboxClient)
+	if err != nil {
+		log.Fatalf("Failed to discover zones: %v", err)
+	}
+	zones := nb.NewZones()
+	for _, cz := range zoneMap {
+		zones.NewZone(cz)
+	}
+
+	query := &netboxlib.IPAddressQuery{IncludeExcluded: true}
+	if addr, err := netip.ParseAddr(target); err == nil {
+		query.Address = addr.String()
+		query.IncludeUnnamed = true
+	} else {
+		query.DNSName = strings.TrimSuffix(target, ".")
+	}
+
+	addrs, err := netboxClient.GetNetboxIPAddresses(query)
+	if err != nil {
+		log.Fatalf("Unable to fetch IP Addresses from Netbox: %v", err)
+	}
+
+	if len(addrs) == 0 {
+		fmt.Printf("NetBox has no IP addresses matching %q\n", target)
+		os.Exit(1)
+	}
+	fmt.Printf("Found %d NetBox IP address(es) matching %q\n\n", len(addrs), target)
+	for _, addr := range addrs {
+		zones.Explain(addr).Write(os.Stdout)
+		fmt.Println()
+	}
+}
+
+// lint audits NetBox data without publishing anything.  It returns
+// the exit code for the process: 0 if no issues were found, 1
+// otherwise.
+func lint(file string, args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	format := fs.String("format", "text", "Output format, \"text\" or \"json\"")
+	fs.Parse(args)
+	if fs.NArg() != 0 || (*format != "text" && *format != "json") {
+		usage()
+	}
+
+	cfg, err := nb.ParseConfig(file)
+	if err != nil {
+		log.Fatalf("Failed to parse config: %v", err)
 	}
 
 	netboxClient := netboxlib.NewClient(cfg.Netbox.Host, cfg.Netbox.Token)
+	zoneMap, _, err := nb.DiscoverZones(cfg, netboxClient)
+	if err != nil {
+		log.Fatalf("Failed to discover zones: %v", err)
+	}
+	zones := nb.NewZones()
+	for _, cz := range zoneMap {
+		zones.NewZone(cz)
+	}
+
 	addrs, err := netboxClient.GetNetboxIPAddresses(nil)
 	if err != nil {
 		log.Fatalf("Unable to fetch IP Addresses from Netbox: %v", err)
 	}
 
-	fmt.Printf("Found %d IP Addresses in %d zones\n", len(addrs), len(newZones.Zones))
+	issues := nb.Lint(cfg, zones, addrs)
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if issues == nil {
+			issues = []*nb.LintIssue{}
+		}
+		enc.Encode(issues)
+	} else {
+		nb.WriteLintText(os.Stdout, issues)
+	}
+
+	if len(issues) > 0 {
+		return 1
+	}
+	return 0
+}
 
-	// Add Netbox IPs to our new zones
-	err = newZones.AddAddrs(addrs)
+// writeReport writes report to filename, or to stdout if filename is
+// "-".
+func writeReport(filename string, report *nb.Report) error {
+	if filename == "-" {
+		return report.Write(os.Stdout)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = report.Write(f)
 	if err != nil {
-		log.Fatalf("Unable to add IP addresses: %v", err)
+		f.Close()
+		return err
 	}
+	return f.Close()
+}
 
-	log.Infof("Created %d zones", len(newZones.Zones))
+// serve runs netbox2dns as a daemon, syncing periodically until it
+// receives SIGTERM or SIGINT.  SIGHUP reloads the config file.
+func serve(file string) {
+	d, err := nb.NewDaemon(file)
+	if err != nil {
+		log.Fatalf("Failed to parse config: %v", err)
+	}
+	runDaemon(d, nil)
+}
 
-	for _, zone := range newZones.Zones {
-		provider, err := nb.NewDNSProvider(ctx, cfg.ZoneMap[zone.Name])
-		if err != nil {
-			log.Fatalf("Failed to create DNS provider for %q: %v", zone.Name, err)
+// serveDNS runs a daemon that keeps the zones in memory and answers
+// DNS queries for them, instead of writing zone files.
+func serveDNS(file string) {
+	d, err := nb.NewDaemon(file)
+	if err != nil {
+		log.Fatalf("Failed to parse config: %v", err)
+	}
+	cfg := d.Config()
+	for _, cz := range cfg.ZoneMap {
+		switch {
+		case cz.Mode != "full":
+			log.Warningf("Zone %q isn't in full mode, so it won't be served", cz.Name)
+		case cfg.DNSServer.SerialFile == "" && cz.SOA != nil && cz.SOA.Serial != "unixtime":
+			log.Warningf("Zone %q uses %q serials, so it won't be served unless dns_server.serial_file is set", cz.Name, cz.SOA.Serial)
 		}
+	}
 
-		for _, rec := range zone.Records {
-			err = provider.WriteRecord(cfg.ZoneMap[zone.Name], rec)
-			if err != nil {
-				log.Errorf("Failed to update record: %v", err)
-			}
+	server := nb.NewDNSServer()
+	d.SetSync(server.Sync)
+	runDaemon(d, server)
+}
+
+// runDaemon runs d until it's interrupted, with its HTTP server if one
+// is configured.  If dnsServer isn't nil, it also answers DNS queries
+// on the `dns_server.listen` addresses.
+func runDaemon(d *nb.Daemon, dnsServer *nb.DNSServer) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Infof("Received SIGHUP, reloading config")
+			d.Reload()
 		}
-		err = provider.Save(cfg.ZoneMap[zone.Name])
-		if err != nil {
-			log.Fatalf("Failed to save: %v", err)
+	}()
+
+	// The listen address is only read at startup; changing it
+	// requires a restart.
+	var server *http.Server
+	if listen := d.Config().Daemon.Listen; listen != "" {
+		server = &http.Server{
+			Addr:              listen,
+			Handler:           d.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
 		}
+		go func() {
+			log.Infof("Listening for HTTP on %s", listen)
+			err := server.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				log.Fatalf("HTTP server failed: %v", err)
+			}
+		}()
+	}
+
+	// Like the HTTP server's, DNS listen addresses are only read
+	// at startup.
+	var dnsServers []*dns.Server
+	if dnsServer != nil {
+		for _, addr := range d.Config().DNSServer.Listen {
+			for _, network := range []string{"udp", "tcp"} {
+				s := &dns.Server{Addr: addr, Net: network, Handler: dnsServer, TsigProvider: dnsServer}
+				dnsServers = append(dnsServers, s)
+				go func() {
+					log.Infof("Listening for DNS on %s/%s", addr, network)
+					if err := s.ListenAndServe(); err != nil {
+						log.Fatalf("DNS server on %s/%s failed: %v", addr, network, err)
+					}
+				}()
+			}
+		}
+	}
+
+	err := d.Run(ctx)
+	if err != nil {
+		log.Fatalf("Daemon failed: %v", err)
+	}
+	log.Infof("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, s := range dnsServers {
+		s.ShutdownContext(shutdownCtx)
+	}
+	if server != nil {
+		server.Shutdown(shutdownCtx)
 	}
 }
@@ -4,14 +4,147 @@
 
 #ZoneFileZone: {
 	zonetype:        "zonefile"
-	name:            string
-	filename:        string
+
+	// Either `name` or `prefix` is required.  Reverse zones may be
+	// defined by `prefix`, like "10.20.0.0/16" or
+	// "2001:db8:100::/48", and their names are derived from it.
+	// Prefixes that aren't on an octet (IPv4) or nibble (IPv6)
+	// boundary are split into several zones, so `filename` must be
+	// a template like "/etc/dns/{{.Name}}.zone".  IPv4 prefixes
+	// longer than /24 are RFC 2317 classless zones, named using
+	// `classless_style` unless `name` is also set.
+	name?:           string
+	prefix?:         string
+	classless_style: *"slash" | "dash" | "range"
+
+	// Classless zones delegated from this zone.  netbox2dns
+	// generates a CNAME for every address in `prefix` pointing into
+	// the classless zone, plus NS records if `nameservers` is set.
+	classless_delegations: [...{
+		prefix:      string
+		style:       *"slash" | "dash" | "range"
+		nameservers: [...#Target]
+	}]
+
+	// `filename` may be a Go template using {{.Name}} (the zone's
+	// name), {{.Kind}} ("forward" or "reverse"), and {{.View}}.
+	// Relative filenames are inside `defaults.directory` if it's
+	// set, and then `filename` defaults to
+	// `defaults.filename_template`.
+	filename: string
+	if config.defaults.directory != "" {
+		filename: *config.defaults.filename_template | string
+	}
+	view:            *"" | string
 	ttl:             *config.defaults.ttl | int & >60 & <=86400
+	records:         [...#Record]
+
+	// "plain" writes one fully-qualified record per line.
+	// "pretty" adds a header comment and `$ORIGIN` and `$TTL`
+	// directives, and writes records in canonical order with
+	// relative names and aligned columns.
+	format: *config.defaults.format | "plain" | "pretty"
+
+	// With `provenance`, each record generated from NetBox is
+	// followed by a comment naming the IP address object it came
+	// from, like "; netbox ipam/ip-addresses/1234 vrf=prod".
+	provenance: *config.defaults.provenance | bool
+
+	// Commands to run after this zone's contents change, before
+	// the global `on_change` hooks.
+	on_change: [...#Hook]
+
+	// In "include" mode, the zone file only has records, and is
+	// meant to be `$INCLUDE`d into a hand-maintained zone.  In
+	// "full" mode, netbox2dns also writes the SOA and apex NS
+	// records, so the file can be loaded directly as a primary
+	// zone.
+	mode: *"include" | "full"
+	if mode == "full" {
+		// At least one nameserver is required.
+		nameservers: [#Target, ...#Target]
+		soa: {
+			// The primary nameserver; defaults to the first
+			// entry in `nameservers`.
+			mname: *nameservers[0] | #Target
+
+			// The zone's contact, either as an email address
+			// or in SOA form, like "hostmaster.example.com.".
+			rname:   string
+			refresh: *3600 | #UInt32
+			retry:   *600 | #UInt32
+			expire:  *1209600 | #UInt32
+			minimum: *300 | #UInt32
+
+			// How serials are chosen when the zone changes:
+			// seconds since 1970, YYYYMMDDnn, or the previous
+			// serial plus one.
+			serial: *"unixtime" | "date" | "increment"
+		}
+
+		// Secondaries to send DNS NOTIFY messages to after the
+		// zone changes, once its `on_change` hooks have
+		// succeeded.  Each is an address or hostname, with an
+		// optional port, like "192.0.2.53" or "[2001:db8::53]:5353".
+		notify: [...string]
+	}
 	...
 }
 
+// Static records, published alongside the records generated from
+// NetBox.  Names are relative to the zone, "@" for the zone's apex,
+// or fully-qualified with a trailing dot.  Targets without a
+// trailing dot are relative to the zone, as in BIND zone files.
+#Record: {
+	name: #RecordName
+	type: "CNAME" | "MX" | "TXT" | "SRV" | "NS" | "CAA"
+	ttl?: int & >0 & <=86400
+
+	if type == "CNAME" || type == "NS" {
+		target: #Target
+	}
+	if type == "MX" {
+		preference: #UInt16
+		target:     #Target
+	}
+	if type == "TXT" {
+		text: string
+	}
+	if type == "SRV" {
+		priority: #UInt16
+		weight:   #UInt16
+		port:     #UInt16
+		target:   #Target
+	}
+	if type == "CAA" {
+		flags: *0 | int & >=0 & <=255
+		tag:   "issue" | "issuewild" | "iodef"
+		value: string
+	}
+}
+
+// A command run after a zone changes, like ["rndc", "reload"].  The
+// command isn't run through a shell; use ["sh", "-c", "..."] for
+// that.  The zone's name, filename, and view, and the number of
+// records added and removed, are passed in the environment as
+// NETBOX2DNS_ZONE, NETBOX2DNS_FILENAME, NETBOX2DNS_VIEW,
+// NETBOX2DNS_ADDED, and NETBOX2DNS_REMOVED.  Hooks that run longer
+// than `timeout` are killed.
+#Hook: {
+	command: [string, ...string]
+	timeout: *"30s" | #Duration
+}
+
+#RecordName: =~"^(@|\\*|(\\*\\.)?[A-Za-z0-9_-]+(\\.[A-Za-z0-9_-]+)*\\.?)$"
+#Target:     =~"^(@|[A-Za-z0-9_-]+(\\.[A-Za-z0-9_-]+)*\\.?|\\.)$"
+#UInt16:     int & >=0 & <=65535
+#UInt32:     int & >=0 & <=4294967295
+
 #Zone: #ZoneFileZone
 
+// A Go-style duration, like "90s" or "15m".
+#Duration: =~"^([0-9]+(\\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$"
+
 // This is the template for the actual configuration.
 config: {
 	// At least one zone is required.
@@ -21,14 +154,19 @@ config: {
 	// the YAML config file, etc.  It contains the same data
 	// as zones:, but it's a map of name -> zone data, which
 	// is less convienent in the config file but more convienent
-	// to use.
+	// to use.  Zones named by `prefix` are added to
+	// it by netbox2dns after their names are derived.
 	zonemap: [string]: #Zone
 	zonemap: {
-		for z in zones {
+		for z in zones if z.name != _|_ {
 			"\(z.name)": z
 		}
 	}
 
+	// Commands to run after any zone's contents change.  They run
+	// once for each changed zone, after the zone's own hooks.
+	on_change: [...#Hook]
+
 	// Netbox config settings.
 	netbox: {
 		host:  string
@@ -38,5 +176,123 @@ config: {
 	// Defaults.
 	defaults: {
 		ttl:       *300 | int
+
+		// Directory for zone files with relative filenames.
+		// Missing directories are created when zones are
+		// written.
+		directory:         *"" | string
+		filename_template: *"{{.Name}}.zone" | string
+
+		format:     *"plain" | "pretty"
+		provenance: *false | bool
+	}
+
+	// When `directory` is set, the previous version of each zone
+	// file is kept in a subdirectory named for the zone whenever
+	// the file is replaced, up to `keep` versions per zone.
+	// `netbox2dns rollback` restores them.
+	backups: {
+		directory: *"" | string
+		keep:      *10 | int & >=1
+		gzip:      *false | bool
+	}
+
+	// Settings for `netbox2dns serve-dns`, which answers DNS
+	// queries for full-mode zones itself, from memory, instead of
+	// writing zone files.  Each address is used for both UDP and
+	// TCP.
+	dns_server: {
+		listen: *[":53"] | [...string]
+
+		// Secondaries may transfer zones (with AXFR or IXFR)
+		// from these addresses or prefixes, like "192.0.2.53"
+		// or "2001:db8::/64".  If `tsig_keys` is set, transfer
+		// requests must also be signed with one of the keys.
+		allow_transfer: [...string]
+		tsig_keys: [...{
+			name:      string
+			algorithm: *"hmac-sha256" | "hmac-sha1" | "hmac-sha224" | "hmac-sha384" | "hmac-sha512"
+
+			// The base64-encoded secret, as generated by
+			// `tsig-keygen`.
+			secret: string
+		}]
+
+		// The number of changes to each zone that are kept in
+		// memory for IXFR.  Secondaries that are further behind
+		// get a full transfer.
+		ixfr_history: *10 | int & >=0
+
+		// Where the last serial of each served zone is kept, so
+		// serials keep increasing after a restart.  Zones using
+		// the "date" or "increment" serial strategies can only
+		// be served if this is set.
+		serial_file: *"" | string
+	}
+
+	// When `repository` is set, zone files that change are
+	// committed to that local git repository after each sync or
+	// rollback, so `git log` shows the history of DNS changes.  The
+	// repository must already exist, and must contain every zone
+	// file.
+	git: {
+		repository:   *"" | string
+		author_name:  *"netbox2dns" | string
+		author_email: *"netbox2dns@localhost" | string
+	}
+
+	// Settings for `netbox2dns serve`.  Syncs run every
+	// `interval`, plus a random delay of up to `jitter`.  After
+	// a failed sync, the interval doubles until it reaches
+	// `max_backoff`.
+	daemon: {
+		interval:    *"15m" | #Duration
+		jitter:      *"1m" | #Duration
+		max_backoff: *"30m" | #Duration
+
+		// Address for the HTTP server, like ":8080".  If
+		// empty, no HTTP server is started.
+		listen: *"" | string
+
+		// NetBox webhooks are accepted on /webhook when a
+		// secret is set.  Zones affected by webhooks are
+		// synced after `debounce`, so that bulk edits in
+		// NetBox are handled in one sync.
+		webhook: {
+			secret:   *"" | string
+			debounce: *"5s" | #Duration
+		}
+	}
+
+	// Prometheus metrics.  The daemon always serves these on
+	// /metrics; if `textfile` is set, they're also written there
+	// after every sync, for node_exporter's textfile collector.
+	metrics: {
+		textfile: *"" | string
+	}
+
+	// Reverse zones can be created automatically for NetBox
+	// prefixes with a given tag or role (or both), like
+	// "dns-reverse".  Each discovered prefix gets the zones that
+	// `prefix` would give it, using `zone` as a template, so
+	// `zone.filename` must use "{{.Name}}".  Zones in `zones` take
+	// precedence, and prefixes already covered by a configured
+	// reverse zone are ignored.  Only prefixes with one of the
+	// NetBox statuses in `status` are used; an empty list allows
+	// any status.
+	discovery: reverse: {
+		tag:    *"" | string
+		role:   *"" | string
+		status: *["active"] | [...string]
+		if tag != "" || role != "" {
+			zone: #Zone
+		}
+	}
+
+	// Settings for `netbox2dns lint`.  With `dual_stack`, every
+	// name with an A record should also have an AAAA record, and
+	// vice versa.
+	lint: {
+		dual_stack: *false | bool
 	}
 }
@@ -7,7 +7,6 @@ import (
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/cuecontext"
-	"cuelang.org/go/encoding/gocode/gocodec"
 	"cuelang.org/go/encoding/json"
 	"cuelang.org/go/encoding/yaml"
 
@@ -30,19 +29,134 @@ type Config struct {
 		Token string `json:"token,omitempty"`
 	} `json:"netbox,omitempty"`
 	Defaults struct {
-		Zonetype string `json:"zonetype,omitempty"`
-		TTL      int64  `json:"ttl,omitempty"`
+		Zonetype         string `json:"zonetype,omitempty"`
+		TTL              int64  `json:"ttl,omitempty"`
+		Directory        string `json:"directory,omitempty"`
+		FilenameTemplate string `json:"filename_template,omitempty"`
+		Format           string `json:"format,omitempty"`
+		Provenance       bool   `json:"provenance,omitempty"`
 	} `json:"defaults,omitempty"`
-	ZoneMap map[string]*ConfigZone `json:"zonemap,omitempty"`
-	Zones   []*ConfigZone          `json:"zones,omitempty"`
+	Daemon struct {
+		Interval   string `json:"interval,omitempty"`
+		Jitter     string `json:"jitter,omitempty"`
+		MaxBackoff string `json:"max_backoff,omitempty"`
+		Listen     string `json:"listen,omitempty"`
+		Webhook    struct {
+			Secret   string `json:"secret,omitempty"`
+			Debounce string `json:"debounce,omitempty"`
+		} `json:"webhook,omitempty"`
+	} `json:"daemon,omitempty"`
+	Metrics struct {
+		Textfile string `json:"textfile,omitempty"`
+	} `json:"metrics,omitempty"`
+	DNSServer struct {
+		Listen        []string         `json:"listen,omitempty"`
+		AllowTransfer []string         `json:"allow_transfer,omitempty"`
+		TSIGKeys      []*ConfigTSIGKey `json:"tsig_keys,omitempty"`
+		IXFRHistory   int              `json:"ixfr_history,omitempty"`
+		SerialFile    string           `json:"serial_file,omitempty"`
+	} `json:"dns_server,omitempty"`
+	Git struct {
+		Repository  string `json:"repository,omitempty"`
+		AuthorName  string `json:"author_name,omitempty"`
+		AuthorEmail string `json:"author_email,omitempty"`
+	} `json:"git,omitempty"`
+	Backups struct {
+		Directory string `json:"directory,omitempty"`
+		Keep      int    `json:"keep,omitempty"`
+		Gzip      bool   `json:"gzip,omitempty"`
+	} `json:"backups,omitempty"`
+	Lint struct {
+		DualStack bool `json:"dual_stack,omitempty"`
+	} `json:"lint,omitempty"`
+	Discovery struct {
+		Reverse struct {
+			Tag    string      `json:"tag,omitempty"`
+			Role   string      `json:"role,omitempty"`
+			Status []string    `json:"status,omitempty"`
+			Zone   *ConfigZone `json:"zone,omitempty"`
+		} `json:"reverse,omitempty"`
+	} `json:"discovery,omitempty"`
+	OnChange []*ConfigHook          `json:"on_change,omitempty"`
+	ZoneMap  map[string]*ConfigZone `json:"zonemap,omitempty"`
+	Zones    []*ConfigZone          `json:"zones,omitempty"`
 }
 
 // ConfigZone matches `Zone` in `config.cue`.
 type ConfigZone struct {
-	ZoneType string `json:"zonetype,omitempty"`
-	Name     string `json:"name,omitempty"`
-	Filename string `json:"filename,omitempty"`
-	TTL      int64  `json:"ttl,omitempty"`
+	ZoneType string          `json:"zonetype,omitempty"`
+	Name     string          `json:"name,omitempty"`
+	Filename string          `json:"filename,omitempty"`
+	TTL      int64           `json:"ttl,omitempty"`
+	View     string          `json:"view,omitempty"`
+	Records  []*ConfigRecord `json:"records,omitempty"`
+
+	Format     string `json:"format,omitempty"`
+	Provenance bool   `json:"provenance,omitempty"`
+
+	OnChange []*ConfigHook `json:"on_change,omitempty"`
+
+	Mode        string     `json:"mode,omitempty"`
+	Nameservers []string   `json:"nameservers,omitempty"`
+	SOA         *ConfigSOA `json:"soa,omitempty"`
+	Notify      []string   `json:"notify,omitempty"`
+
+	Prefix               string              `json:"prefix,omitempty"`
+	ClasslessStyle       string              `json:"classless_style,omitempty"`
+	ClasslessDelegations []*ConfigDelegation `json:"classless_delegations,omitempty"`
+}
+
+// ConfigHook matches `Hook` in `config.cue`.  It's a command that's
+// run after a zone changes.
+type ConfigHook struct {
+	Command []string `json:"command,omitempty"`
+	Timeout string   `json:"timeout,omitempty"`
+}
+
+// ConfigTSIGKey matches `dns_server.tsig_keys` in `config.cue`.  It's
+// a key that secondaries can use to sign zone transfer requests.
+type ConfigTSIGKey struct {
+	Name      string `json:"name,omitempty"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Secret    string `json:"secret,omitempty"`
+}
+
+// ConfigDelegation matches `classless_delegations` in `config.cue`.
+// It describes an RFC 2317 classless reverse zone that's delegated
+// from a zone that netbox2dns manages.
+type ConfigDelegation struct {
+	Prefix      string   `json:"prefix,omitempty"`
+	Style       string   `json:"style,omitempty"`
+	Nameservers []string `json:"nameservers,omitempty"`
+}
+
+// ConfigSOA matches `soa` in `config.cue`.  It's only used by zones
+// in "full" mode.
+type ConfigSOA struct {
+	MName   string `json:"mname,omitempty"`
+	RName   string `json:"rname,omitempty"`
+	Refresh uint32 `json:"refresh,omitempty"`
+	Retry   uint32 `json:"retry,omitempty"`
+	Expire  uint32 `json:"expire,omitempty"`
+	Minimum uint32 `json:"minimum,omitempty"`
+	Serial  string `json:"serial,omitempty"`
+}
+
+// ConfigRecord matches `Record` in `config.cue`.  Which fields are
+// used depends on the record's type.
+type ConfigRecord struct {
+	Name       string `json:"name,omitempty"`
+	Type       string `json:"type,omitempty"`
+	TTL        int64  `json:"ttl,omitempty"`
+	Target     string `json:"target,omitempty"`     // CNAME, MX, SRV, NS
+	Preference int    `json:"preference,omitempty"` // MX
+	Text       string `json:"text,omitempty"`       // TXT
+	Priority   int    `json:"priority,omitempty"`   // SRV
+	Weight     int    `json:"weight,omitempty"`     // SRV
+	Port       int    `json:"port,omitempty"`       // SRV
+	Flags      int    `json:"flags,omitempty"`      // CAA
+	Tag        string `json:"tag,omitempty"`        // CAA
+	Value      string `json:"value,omitempty"`      // CAA
 }
 
 // This causes "config.cue" in the current directory to be embedded
@@ -95,79 +209,97 @@ func ParseConfig(filename string) (*Config, error) {
 
 	cctx := cuecontext.New()
 
+	value, err := loadConfig(filename, cctx)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err = applySchema(value, cctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = value.Decode(config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Config.expandZones()
+	if err != nil {
+		return nil, err
+	}
+
+	return &(config.Config), nil
+}
+
+// loadConfig reads a config file in any of the supported formats and
+// returns it as a CUE value, without applying the schema.  Position
+// information for the file is preserved, so errors found later can
+// be reported against the user's file.
+func loadConfig(filename string, cctx *cue.Context) (cue.Value, error) {
+	var value cue.Value
+	var err error
+
 	if strings.HasSuffix(filename, ".yml") || strings.HasSuffix(filename, ".yaml") {
-		err := parseYAML(filename, config, cctx)
-		if err != nil {
-			return nil, err
-		}
+		value, err = parseYAML(filename, cctx)
 	} else if strings.HasSuffix(filename, ".json") {
-		err := parseJSON(filename, config, cctx)
-		if err != nil {
-			return nil, err
-		}
+		value, err = parseJSON(filename, cctx)
 	} else if strings.HasSuffix(filename, ".cue") {
-		err := parseCUE(filename, config, cctx)
-		if err != nil {
-			return nil, err
-		}
+		value, err = parseCUE(filename, cctx)
 	} else {
-		return nil, fmt.Errorf("Unknown config format for %q", filename)
+		return value, fmt.Errorf("Unknown config format for %q", filename)
+	}
+	if err != nil {
+		return value, err
 	}
 
-	// Compile "config.cue"
-	schema := cctx.CompileBytes(cueSchema)
+	return value, value.Err()
+}
 
-	// Apply the schema to the results of the parsed YAML file.
-	// This is basically equivalent to 'cue eval config.cue
-	// config.yaml'.
-	codec := gocodec.New((*cue.Runtime)(cctx), nil)
-	err := codec.Complete(schema, config)
-	if err != nil {
-		return nil, err
+// applySchema unifies a parsed config with the schema from
+// `config.cue` and verifies that the result is complete.  This is
+// basically equivalent to 'cue vet -c config.cue config.yaml'.
+func applySchema(value cue.Value, cctx *cue.Context) (cue.Value, error) {
+	schema := cctx.CompileBytes(cueSchema, cue.Filename("config.cue"))
+	if err := schema.Err(); err != nil {
+		return schema, err
 	}
 
-	return &(config.Config), nil
+	unified := schema.Unify(value)
+	err := unified.Validate(cue.Concrete(true))
+	return unified, err
 }
 
-// parseYAML parses a YAML (.yml, .yaml) file into a ConfigRoot.
-func parseYAML(filename string, cfg *ConfigRoot, cctx *cue.Context) error {
+// parseYAML parses a YAML (.yml, .yaml) file into a CUE value.
+func parseYAML(filename string, cctx *cue.Context) (cue.Value, error) {
 	// yaml.Extract will do the read itself if the second parameter is nil.
 	yamlAST, err := yaml.Extract(filename, nil)
 	if err != nil {
-		return err
+		return cue.Value{}, err
 	}
-	yamlValue := cctx.BuildFile(yamlAST)
-	yamlValue.Decode(cfg)
-
-	return nil
+	return cctx.BuildFile(yamlAST), nil
 }
 
-// parseJSON parses a JSON file into a ConfigRoot.
-func parseJSON(filename string, cfg *ConfigRoot, cctx *cue.Context) error {
+// parseJSON parses a JSON file into a CUE value.
+func parseJSON(filename string, cctx *cue.Context) (cue.Value, error) {
 	// json.Extract will *not* do the read itself if the second
 	// parameter is nil, unlike yaml.Extract.
 	b, err := os.ReadFile(filename)
 	if err != nil {
-		return err
+		return cue.Value{}, err
 	}
 	jsonAST, err := json.Extract(filename, b)
 	if err != nil {
-		return err
+		return cue.Value{}, err
 	}
-	jsonValue := cctx.BuildExpr(jsonAST)
-	jsonValue.Decode(cfg)
-
-	return nil
+	return cctx.BuildExpr(jsonAST), nil
 }
 
-// parseCUE parses a .cue-format config file into a ConfigRoot
-func parseCUE(filename string, cfg *ConfigRoot, cctx *cue.Context) error {
+// parseCUE parses a .cue-format config file into a CUE value.
+func parseCUE(filename string, cctx *cue.Context) (cue.Value, error) {
 	b, err := os.ReadFile(filename)
 	if err != nil {
-		return err
+		return cue.Value{}, err
 	}
-	config := cctx.CompileBytes(b)
-	config.Decode(cfg)
-
-	return nil
+	return cctx.CompileBytes(b, cue.Filename(filename)), nil
 }
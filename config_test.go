@@ -1,6 +1,8 @@
 package netbox2dns
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -104,3 +106,156 @@ func TestValidateYaml(t *testing.T) {
 		t.Errorf("Should have failed validation, but succeeded.")
 	}
 }
+
+func TestCheckConfig(t *testing.T) {
+	problems, cfg := CheckConfig("testdata/config4/conf.yaml")
+	if len(problems) != 0 {
+		t.Errorf("CheckConfig(config4) returned %d problems, want 0: %v", len(problems), problems)
+	}
+	if cfg == nil {
+		t.Errorf("CheckConfig(config4) returned nil config")
+	}
+
+	problems, _ = CheckConfig("testdata/config6/conf.yaml")
+
+	want := []string{
+		"testdata/config6/conf.yaml:13:7: error: config.zones[0].ttl: conflicting values 300 and 30",
+		"testdata/config6/conf.yaml:13:7: error: config.zones[0].ttl: invalid value 30 (out of bound >60)",
+		"testdata/config6/conf.yaml:14:7: error: zone \"example.com.\" can never receive records: name must not end with '.'",
+		"testdata/config6/conf.yaml:17:7: warning: unknown key \"colour\" in config.zones[1]",
+		"testdata/config6/conf.yaml:18:7: error: zone \"internal.example.com\" is also defined at config.zones[0]",
+		"testdata/config6/conf.yaml:19:7: error: zone file \"example-com.zone\" is also used by config.zones[1]",
+		"testdata/config6/conf.yaml:22:7: error: zone file for \"10.in-addr.arpa\" is not writable: ",
+	}
+
+	if len(problems) != len(want) {
+		t.Fatalf("CheckConfig(config6) returned %d problems, want %d: %v", len(problems), len(want), problems)
+	}
+	for i, p := range problems {
+		if !strings.HasPrefix(p.String(), want[i]) {
+			t.Errorf("CheckConfig(config6) problem %d: got %q, want %q", i, p.String(), want[i])
+		}
+	}
+}
+
+func TestCheckConfigEmpty(t *testing.T) {
+	for _, test := range []struct {
+		filename, want string
+	}{
+		{"testdata/config1/conf.yaml", "testdata/config1/conf.yaml:1:1: error: config is empty"},
+		{"testdata/config3/conf.cue", "testdata/config3/conf.cue:1:1: error: config is empty"},
+		{"testdata/config5/conf1.yaml", ""},
+	} {
+		problems, _ := CheckConfig(test.filename)
+		if test.want == "" {
+			for _, p := range problems {
+				if p.Line == 1 && p.Column == 1 && strings.Contains(p.Message, "config") {
+					t.Errorf("CheckConfig(%s): got %q, want no problem with the top level", test.filename, p)
+				}
+			}
+			continue
+		}
+		if len(problems) != 1 || problems[0].String() != test.want {
+			t.Errorf("CheckConfig(%s): got %v, want [%s]", test.filename, problems, test.want)
+		}
+	}
+}
+
+func TestCheckNestedZones(t *testing.T) {
+	problems, _ := CheckConfig("testdata/config12/conf.yaml")
+
+	// Only zones inside of full-mode zones need a delegation.
+	want := "testdata/config12/conf.yaml:22:7: warning: zone \"dev.example.com\" is inside zone \"example.com\", which doesn't delegate it with NS records"
+	if len(problems) != 1 || problems[0].String() != want {
+		t.Errorf("CheckConfig(config12): got %v, want [%s]", problems, want)
+	}
+}
+
+func TestUnreachableZone(t *testing.T) {
+	tests := []struct {
+		name      string
+		reachable bool
+	}{
+		{"example.com", true},
+		{"10.in-addr.arpa", true},
+		{"0.0.0.0.ip6.arpa", true},
+		{"", false},
+		{"example.com.", false},
+		{"1.2.3.4.5.in-addr.arpa", false},
+		{"256.in-addr.arpa", false},
+		{"00.0.0.0.ip6.arpa", false},
+	}
+
+	for _, test := range tests {
+		got := unreachableZone(test.name) == ""
+		if got != test.reachable {
+			t.Errorf("unreachableZone(%q): got reachable=%v, want %v", test.name, got, test.reachable)
+		}
+	}
+}
+
+func TestParseStaticRecords(t *testing.T) {
+	cfg, err := ParseConfig("testdata/config7/conf.yaml")
+	if err != nil {
+		t.Fatalf("Unable to parse config: %v", err)
+	}
+
+	records := cfg.ZoneMap["example.com"].Records
+	if len(records) != 6 {
+		t.Fatalf("len(records) wrong; got %d want 6", len(records))
+	}
+	want := ConfigRecord{Name: "_sip._tcp", Type: "SRV", Priority: 10, Weight: 5, Port: 5060, Target: "sip"}
+	if *records[3] != want {
+		t.Errorf("records[3] wrong; got %+v want %+v", *records[3], want)
+	}
+	if records[2].TTL != 3600 || records[0].TTL != 0 {
+		t.Errorf("record TTLs wrong; got %d and %d, want 3600 and 0", records[2].TTL, records[0].TTL)
+	}
+
+	problems, _ := CheckConfig("testdata/config7/conf.yaml")
+	if len(problems) != 0 {
+		t.Errorf("CheckConfig(config7) returned %d problems, want 0: %v", len(problems), problems)
+	}
+}
+
+func TestParseFullMode(t *testing.T) {
+	cfg, err := ParseConfig("testdata/config8/conf.yaml")
+	if err != nil {
+		t.Fatalf("Unable to parse config: %v", err)
+	}
+
+	z := cfg.ZoneMap["example.com"]
+	if z.Mode != "full" {
+		t.Errorf("z.Mode wrong; got %q want %q", z.Mode, "full")
+	}
+	want := ConfigSOA{MName: "ns1", RName: "hostmaster@example.com", Refresh: 3600, Retry: 900, Expire: 1209600, Minimum: 300, Serial: "date"}
+	if z.SOA == nil || *z.SOA != want {
+		t.Errorf("z.SOA wrong; got %+v want %+v", z.SOA, want)
+	}
+	if z.Format != "pretty" {
+		t.Errorf("z.Format wrong; got %q want %q", z.Format, "pretty")
+	}
+	if want := []string{"192.0.2.53", "[2001:db8::53]:5353"}; !reflect.DeepEqual(z.Notify, want) {
+		t.Errorf("z.Notify wrong; got %q want %q", z.Notify, want)
+	}
+	wantHooks := []*ConfigHook{{Command: []string{"rndc", "reload", "example.com"}, Timeout: "2m"}}
+	if !reflect.DeepEqual(z.OnChange, wantHooks) {
+		t.Errorf("z.OnChange wrong; got %+v want %+v", z.OnChange, wantHooks)
+	}
+	wantHooks = []*ConfigHook{{Command: []string{"nsd-control", "reload"}, Timeout: "30s"}}
+	if !reflect.DeepEqual(cfg.OnChange, wantHooks) {
+		t.Errorf("cfg.OnChange wrong; got %+v want %+v", cfg.OnChange, wantHooks)
+	}
+
+	if want := []string{":53"}; !reflect.DeepEqual(cfg.DNSServer.Listen, want) {
+		t.Errorf("cfg.DNSServer.Listen wrong; got %q want %q", cfg.DNSServer.Listen, want)
+	}
+
+	z = cfg.ZoneMap["10.in-addr.arpa"]
+	if z.Mode != "include" || z.SOA != nil {
+		t.Errorf("10.in-addr.arpa: got mode %q and SOA %+v, want include mode without an SOA", z.Mode, z.SOA)
+	}
+	if z.Format != "plain" {
+		t.Errorf("10.in-addr.arpa: z.Format wrong; got %q want %q", z.Format, "plain")
+	}
+}
@@ -0,0 +1,559 @@
+package netbox2dns
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/token"
+)
+
+// ConfigProblem describes a single error or warning found by
+// CheckConfig.
+type ConfigProblem struct {
+	Filename string
+	Line     int
+	Column   int
+	Warning  bool
+	Message  string
+}
+
+// String formats a ConfigProblem as `file:line:column: severity:
+// message`, the same way that compilers report errors.
+func (p *ConfigProblem) String() string {
+	severity := "error"
+	if p.Warning {
+		severity = "warning"
+	}
+
+	loc := p.Filename
+	if p.Line > 0 {
+		loc = fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, severity, p.Message)
+}
+
+// configChecker collects problems found while checking a single
+// config file.
+type configChecker struct {
+	filename string
+	data     cue.Value
+	problems []*ConfigProblem
+}
+
+// CheckConfig performs a strict check of a config file.  Unlike
+// ParseConfig, it doesn't stop at the first problem; it returns every
+// error and warning that it can find, each with the position in the
+// config file that caused it.  In addition to schema validation, it
+// looks for unknown keys, duplicate zones, child zones that their
+// parent zone doesn't delegate, zones that can never receive records,
+// and zone files that can't be written.
+//
+// The parsed Config is returned if the file could be decoded, even if
+// problems were found.
+func CheckConfig(filename string) ([]*ConfigProblem, *Config) {
+	c := &configChecker{filename: filename}
+
+	cctx := cuecontext.New()
+	data, err := loadConfig(filename, cctx)
+	if err != nil {
+		c.addCUEErrors(err)
+		return c.problems, nil
+	}
+	c.data = data
+
+	// An empty file, or one without `config:`, would otherwise be
+	// reported as the whole schema failing to match.
+	if msg := emptyConfig(data); msg != "" {
+		c.problems = append(c.problems, &ConfigProblem{Filename: filename, Line: 1, Column: 1, Message: msg})
+		return c.problems, nil
+	}
+
+	c.checkUnknownKeys(data, reflect.TypeOf(ConfigRoot{}), cue.Path{})
+
+	value, err := applySchema(data, cctx)
+	if err != nil {
+		c.addCUEErrors(err)
+
+		// Keep going with the raw data, so that problems in
+		// other zones are still found.
+		config := &ConfigRoot{}
+		if data.Decode(config) == nil {
+			c.checkZones(&config.Config)
+		}
+		return c.sorted(), nil
+	}
+
+	config := &ConfigRoot{}
+	err = value.Decode(config)
+	if err != nil {
+		c.addCUEErrors(err)
+		return c.sorted(), nil
+	}
+
+	c.checkZones(&config.Config)
+
+	return c.sorted(), &config.Config
+}
+
+// sorted returns all problems ordered by their position in the file.
+func (c *configChecker) sorted() []*ConfigProblem {
+	sort.SliceStable(c.problems, func(i, j int) bool {
+		if c.problems[i].Line != c.problems[j].Line {
+			return c.problems[i].Line < c.problems[j].Line
+		}
+		return c.problems[i].Column < c.problems[j].Column
+	})
+	return c.problems
+}
+
+// add records a new problem at pos.  If pos isn't inside of the
+// config file being checked, then the problem is reported against
+// the file as a whole.
+func (c *configChecker) add(pos token.Pos, warning bool, format string, args ...interface{}) {
+	p := &ConfigProblem{
+		Filename: c.filename,
+		Warning:  warning,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if pos.IsValid() && pos.Filename() == c.filename {
+		p.Line = pos.Line()
+		p.Column = pos.Column()
+	}
+	c.problems = append(c.problems, p)
+}
+
+// posOf returns the position of the value at path in the config
+// file, or token.NoPos if it doesn't appear there.
+func (c *configChecker) posOf(path cue.Path) token.Pos {
+	if !c.data.Exists() {
+		return token.NoPos
+	}
+	v := c.data.LookupPath(path)
+	if !v.Exists() {
+		return token.NoPos
+	}
+	return v.Pos()
+}
+
+// errorPath converts the path from a CUE error into a cue.Path.
+// List indexes are reported as plain numbers in errors.
+func errorPath(elems []string) cue.Path {
+	sels := make([]cue.Selector, len(elems))
+	for i, e := range elems {
+		if n, err := strconv.Atoi(e); err == nil {
+			sels[i] = cue.Index(n)
+		} else {
+			sels[i] = cue.Str(e)
+		}
+	}
+	return cue.MakePath(sels...)
+}
+
+// addCUEErrors converts each error from CUE into a ConfigProblem.
+// CUE reports positions in both the config file and `config.cue`;
+// whenever possible, the position in the config file is used.
+func (c *configChecker) addCUEErrors(err error) {
+	seen := map[string]bool{}
+	added := false
+
+	for _, e := range errors.Errors(err) {
+		path := errorPath(e.Path())
+		format, args := e.Msg()
+		msg := fmt.Sprintf(format, args...)
+		if msg == "" {
+			// Not a CUE error, such as a failed read.
+			msg = e.Error()
+		}
+
+		// Errors in `zonemap` are duplicates of errors in
+		// `zones` or conflicts between zones with the same name,
+		// which checkZones reports more clearly.  Wrappers like
+		// "2 errors in empty disjunction:" are followed by the
+		// errors that they summarize.
+		if strings.HasPrefix(path.String(), "config.zonemap") || strings.HasSuffix(msg, ":") {
+			added = true
+			continue
+		}
+		if strings.HasPrefix(msg, "incomplete value") {
+			msg = fmt.Sprintf("missing required value (%s)", msg)
+		}
+		if len(path.Selectors()) > 0 {
+			msg = path.String() + ": " + msg
+		}
+
+		// Prefer the position of the value itself; CUE's
+		// input positions include every value that it was
+		// unified with, such as defaults.
+		pos := c.posOf(path)
+		if !pos.IsValid() || pos.Filename() != c.filename {
+			for _, p := range append([]token.Pos{e.Position()}, e.InputPositions()...) {
+				if p.IsValid() && p.Filename() == c.filename {
+					pos = p
+					break
+				}
+			}
+		}
+
+		key := fmt.Sprintf("%v %s", pos, msg)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		c.add(pos, false, "%s", msg)
+		added = true
+	}
+
+	if !added {
+		c.add(token.NoPos, false, "%v", err)
+	}
+}
+
+// checkUnknownKeys walks the parsed config file and warns about any
+// keys that don't correspond to a field in the Go config structures.
+// These are usually typos, and would otherwise be silently ignored.
+func (c *configChecker) checkUnknownKeys(v cue.Value, t reflect.Type, path cue.Path) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		known := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			known[name] = f.Type
+		}
+
+		iter, err := v.Fields()
+		if err != nil {
+			return
+		}
+		for iter.Next() {
+			sel := iter.Selector()
+			label := sel.Unquoted()
+			childPath := cue.MakePath(append(path.Selectors(), sel)...)
+			ft, ok := known[label]
+			if !ok {
+				c.add(iter.Value().Pos(), true, "unknown key %q in %s", label, pathOrRoot(path))
+				continue
+			}
+			c.checkUnknownKeys(iter.Value(), ft, childPath)
+		}
+	case reflect.Map:
+		iter, err := v.Fields()
+		if err != nil {
+			return
+		}
+		for iter.Next() {
+			childPath := cue.MakePath(append(path.Selectors(), iter.Selector())...)
+			c.checkUnknownKeys(iter.Value(), t.Elem(), childPath)
+		}
+	case reflect.Slice:
+		iter, err := v.List()
+		if err != nil {
+			return
+		}
+		for i := 0; iter.Next(); i++ {
+			childPath := cue.MakePath(append(path.Selectors(), cue.Index(i))...)
+			c.checkUnknownKeys(iter.Value(), t.Elem(), childPath)
+		}
+	}
+}
+
+// emptyConfig returns a description of the problem if v, a parsed
+// config file, is empty or doesn't have a top-level `config` key.
+// Otherwise it returns "".
+func emptyConfig(v cue.Value) string {
+	if !v.Exists() || v.IncompleteKind() == cue.NullKind {
+		return "config is empty"
+	}
+	if v.IncompleteKind() != cue.StructKind {
+		return "config must be a map with a top-level `config:` key"
+	}
+	if iter, err := v.Fields(); err == nil && !iter.Next() {
+		return "config is empty"
+	}
+	root := v.LookupPath(cue.ParsePath("config"))
+	if !root.Exists() {
+		return "missing `config:` at the top level"
+	}
+	if root.IncompleteKind() == cue.NullKind {
+		return "config is empty"
+	}
+	return ""
+}
+
+func pathOrRoot(p cue.Path) string {
+	if len(p.Selectors()) == 0 {
+		return "top level"
+	}
+	return p.String()
+}
+
+// checkZones performs semantic checks on the zones in a decoded
+// config.  Zones are expanded as they are by ParseConfig, so zones
+// defined by prefix are checked individually.
+func (c *configChecker) checkZones(cfg *Config) {
+	names := map[string]int{}
+	filenames := map[string]int{}
+	positions := map[*ConfigZone]token.Pos{}
+	var zones []*ConfigZone
+	cfg.ZoneMap = make(map[string]*ConfigZone)
+
+	for i, cz := range cfg.Zones {
+		zonePath := cue.ParsePath(fmt.Sprintf("config.zones[%d]", i))
+		namePos := c.posOf(cue.MakePath(append(zonePath.Selectors(), cue.Str("name"))...))
+		if cz.Name == "" && cz.Prefix != "" {
+			namePos = c.posOf(cue.MakePath(append(zonePath.Selectors(), cue.Str("prefix"))...))
+		}
+		expanded, err := cz.expand(cfg.Defaults.Directory)
+		if err != nil {
+			c.add(namePos, false, "%v", err)
+			continue
+		}
+		zones = append(zones, expanded...)
+
+		for _, ez := range expanded {
+			positions[ez] = namePos
+			if prev, ok := names[ez.Name]; ok {
+				c.add(namePos, false, "zone %q is also defined at config.zones[%d]", ez.Name, prev)
+			} else {
+				names[ez.Name] = i
+				cfg.ZoneMap[ez.Name] = ez
+			}
+
+			if ez.Prefix != "" {
+				// Names derived from prefixes were checked by expand.
+			} else if reason := unreachableZone(ez.Name); reason != "" {
+				c.add(namePos, false, "zone %q can never receive records: %s", ez.Name, reason)
+			} else if strings.ToLower(ez.Name) != ez.Name {
+				c.add(namePos, true, "zone %q contains upper-case letters; zones are matched case-sensitively", ez.Name)
+			}
+
+			zone := &Zone{Name: ez.Name, static: ez.Records}
+			if _, err := zone.AddStaticRecords(); err != nil {
+				c.add(c.posOf(cue.MakePath(append(zonePath.Selectors(), cue.Str("records"))...)), false, "%v", err)
+			}
+
+			if ez.ZoneType != "zonefile" {
+				continue
+			}
+
+			filenamePos := c.posOf(cue.MakePath(append(zonePath.Selectors(), cue.Str("filename"))...))
+			if prev, ok := filenames[ez.Filename]; ok {
+				c.add(filenamePos, false, "zone file %q is also used by config.zones[%d]", ez.Filename, prev)
+			} else {
+				filenames[ez.Filename] = i
+			}
+			if err := checkWritable(ez.Filename); err != nil {
+				c.add(filenamePos, false, "zone file for %q is not writable: %v", ez.Name, err)
+			}
+			if cfg.Git.Repository != "" {
+				if _, err := repositoryPath(cfg.Git.Repository, ez.Filename); err != nil {
+					c.add(filenamePos, false, "%v", err)
+				}
+			}
+		}
+		c.checkHooks(cz.OnChange, cue.MakePath(append(zonePath.Selectors(), cue.Str("on_change"))...))
+		if len(cz.Notify) > 0 && cz.Mode != "full" {
+			c.add(c.posOf(cue.MakePath(append(zonePath.Selectors(), cue.Str("notify"))...)), false, "notify is only supported for zones in full mode")
+		}
+		for j, target := range cz.Notify {
+			host, port, err := net.SplitHostPort(notifyAddr(target))
+			if err == nil {
+				_, err = strconv.ParseUint(port, 10, 16)
+			}
+			if err != nil || host == "" {
+				c.add(c.posOf(cue.MakePath(append(zonePath.Selectors(), cue.Str("notify"), cue.Index(j))...)), false, "invalid notify target %q", target)
+			}
+		}
+	}
+	cfg.Zones = zones
+	c.checkNestedZones(zones, positions)
+	c.checkHooks(cfg.OnChange, cue.ParsePath("config.on_change"))
+
+	if cfg.Backups.Directory != "" {
+		if err := checkWritable(filepath.Join(cfg.Backups.Directory, "backup")); err != nil {
+			c.add(c.posOf(cue.ParsePath("config.backups.directory")), false, "backup directory is not writable: %v", err)
+		}
+	}
+
+	if cfg.DNSServer.SerialFile != "" {
+		if err := checkWritable(cfg.DNSServer.SerialFile); err != nil {
+			c.add(c.posOf(cue.ParsePath("config.dns_server.serial_file")), false, "serial file is not writable: %v", err)
+		}
+	}
+
+	if _, err := newTransferConfig(cfg); err != nil {
+		c.add(c.posOf(cue.ParsePath("config.dns_server")), false, "%v", err)
+	}
+
+	if cfg.Git.Repository != "" {
+		if _, err := os.Stat(filepath.Join(cfg.Git.Repository, ".git")); err != nil {
+			c.add(c.posOf(cue.ParsePath("config.git.repository")), false, "%q is not a git repository: %v", cfg.Git.Repository, err)
+		}
+	}
+
+	if err := cfg.checkDiscovery(); err != nil {
+		c.add(c.posOf(cue.ParsePath("config.discovery.reverse.zone")), false, "%v", err)
+	}
+}
+
+// checkNestedZones warns about zones inside of another zone in full
+// mode that the parent doesn't delegate with NS records.  Since
+// netbox2dns owns the whole parent zone, nothing else will add the
+// delegation, and resolvers will never find the child zone.  Parents
+// in other modes may be delegated by records that aren't managed here.
+// Only the closest enclosing zone is checked.
+func (c *configChecker) checkNestedZones(zones []*ConfigZone, positions map[*ConfigZone]token.Pos) {
+	for _, child := range zones {
+		var parent *ConfigZone
+		for _, cz := range zones {
+			if strings.HasSuffix(strings.ToLower(child.Name), "."+strings.ToLower(cz.Name)) && (parent == nil || len(cz.Name) > len(parent.Name)) {
+				parent = cz
+			}
+		}
+		if parent != nil && parent.Mode == "full" && !delegates(parent, child.Name) {
+			c.add(positions[child], true, "zone %q is inside zone %q, which doesn't delegate it with NS records", child.Name, parent.Name)
+		}
+	}
+}
+
+// delegates returns true if the config for zone cz includes NS
+// records for the zone named child, either as static records or for a
+// classless delegation.
+func delegates(cz *ConfigZone, child string) bool {
+	child = strings.ToLower(child) + "."
+	for _, r := range cz.Records {
+		if r.Type == "NS" && strings.ToLower(absoluteName(r.Name, cz.Name)) == child {
+			return true
+		}
+	}
+	for _, d := range cz.ClasslessDelegations {
+		prefix, err := netip.ParsePrefix(d.Prefix)
+		if err != nil || len(d.Nameservers) == 0 {
+			continue
+		}
+		name, err := ClasslessZoneName(prefix, d.Style)
+		if err == nil && strings.ToLower(name)+"." == child {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHooks warns about on_change hooks whose commands can't be
+// found.  They're only warnings, since the command may be installed
+// by the time netbox2dns runs for real.
+func (c *configChecker) checkHooks(hooks []*ConfigHook, path cue.Path) {
+	for i, hook := range hooks {
+		if len(hook.Command) == 0 {
+			continue
+		}
+		if _, err := exec.LookPath(hook.Command[0]); err != nil {
+			pos := c.posOf(cue.MakePath(append(path.Selectors(), cue.Index(i), cue.Str("command"))...))
+			c.add(pos, true, "on_change command %q not found: %v", hook.Command[0], err)
+		}
+	}
+}
+
+// unreachableZone returns a description of why no record could ever
+// be added to the named zone, or "" if the zone looks usable.
+func unreachableZone(name string) string {
+	switch {
+	case name == "":
+		return "name is empty"
+	case strings.HasSuffix(name, "."):
+		return "name must not end with '.'"
+	case strings.Contains(name, ".."):
+		return "name contains an empty label"
+	}
+
+	lower := strings.ToLower(name)
+	if lower == "in-addr.arpa" || strings.HasSuffix(lower, ".in-addr.arpa") {
+		labels := strings.Split(strings.TrimSuffix(lower, "in-addr.arpa"), ".")
+		labels = labels[:len(labels)-1]
+		if len(labels) > 4 {
+			return "in-addr.arpa zones have at most 4 octets"
+		}
+		for _, l := range labels {
+			if n, err := strconv.Atoi(l); err != nil || n < 0 || n > 255 || strconv.Itoa(n) != l {
+				return fmt.Sprintf("%q is not a valid in-addr.arpa octet", l)
+			}
+		}
+	}
+	if lower == "ip6.arpa" || strings.HasSuffix(lower, ".ip6.arpa") {
+		labels := strings.Split(strings.TrimSuffix(lower, "ip6.arpa"), ".")
+		labels = labels[:len(labels)-1]
+		if len(labels) > 32 {
+			return "ip6.arpa zones have at most 32 nibbles"
+		}
+		for _, l := range labels {
+			if len(l) != 1 || !strings.Contains("0123456789abcdef", l) {
+				return fmt.Sprintf("%q is not a valid ip6.arpa nibble", l)
+			}
+		}
+	}
+	return ""
+}
+
+// checkWritable verifies that filename can be written, without
+// modifying it.  If the file doesn't exist yet, then its directory
+// (or its closest existing ancestor) needs to allow new files to be
+// created.
+func checkWritable(filename string) error {
+	if filename == "" {
+		return fmt.Errorf("no filename specified")
+	}
+
+	fi, err := os.Stat(filename)
+	if err == nil {
+		if fi.IsDir() {
+			return fmt.Errorf("%q is a directory", filename)
+		}
+		f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	// Missing directories are created when the zone is written,
+	// so check the closest directory that already exists.
+	dir := filepath.Dir(filename)
+	for {
+		fi, err := os.Stat(dir)
+		if err == nil && !fi.IsDir() {
+			return fmt.Errorf("%q is not a directory", dir)
+		}
+		if err == nil || !os.IsNotExist(err) || dir == filepath.Dir(dir) {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	f, err := os.CreateTemp(dir, ".netbox2dns-check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,339 @@
+package netbox2dns
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// Defaults used when the daemon settings can't be parsed.  These
+// match the defaults in `config.cue`.
+const (
+	defaultInterval   = 15 * time.Minute
+	defaultJitter     = time.Minute
+	defaultMaxBackoff = 30 * time.Minute
+)
+
+// Daemon runs Sync repeatedly, as `netbox2dns serve`.  Runs happen
+// every `daemon.interval` plus a random jitter; after a failed run the
+// delay doubles until it reaches `daemon.max_backoff`.  Only one sync
+// ever runs at a time; requests for another sync that arrive while one
+// is running are coalesced into a single follow-up run.
+type Daemon struct {
+	configFile string
+
+	mu          sync.Mutex // protects cfg, status, discovered, and pending*
+	cfg         *Config
+	status      DaemonStatus
+	discovered  []*ConfigZone // Zones discovered by the last successful sync
+	pendingAll  bool
+	pendingZone map[string]bool
+
+	reload  chan struct{}
+	trigger chan struct{}
+	metrics *Metrics
+
+	// sync performs a single run.  It's replaceable for tests.
+	sync func(ctx context.Context, cfg *Config, opts SyncOptions) (*SyncResult, error)
+}
+
+// DaemonStatus describes the state of a Daemon.
+type DaemonStatus struct {
+	Runs        int       // Number of completed sync runs
+	Failures    int       // Number of consecutive failed runs
+	LastRun     time.Time // When the last run finished
+	LastSuccess time.Time // When the last successful run finished
+	LastError   error     // The error from the last run, or nil
+	NextRun     time.Time // When the next run is scheduled
+}
+
+// NewDaemon creates a Daemon using the config in configFile.  The
+// config is re-read when Reload is called.
+func NewDaemon(configFile string) (*Daemon, error) {
+	cfg, err := ParseConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Daemon{
+		configFile:  configFile,
+		cfg:         cfg,
+		pendingZone: make(map[string]bool),
+		reload:      make(chan struct{}, 1),
+		trigger:     make(chan struct{}, 1),
+		metrics:     NewMetrics(),
+		sync:        Sync,
+	}, nil
+}
+
+// SetSync replaces the function the daemon calls for each run, which
+// is normally Sync.  `netbox2dns serve-dns` uses this to update its
+// in-memory zones instead of writing zone files.  It must be called
+// before Run.
+func (d *Daemon) SetSync(sync func(ctx context.Context, cfg *Config, opts SyncOptions) (*SyncResult, error)) {
+	d.sync = sync
+}
+
+// Config returns the config currently in use.
+func (d *Daemon) Config() *Config {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cfg
+}
+
+// zones returns every zone the daemon knows about: the configured
+// zones, plus any reverse zones discovered by the last successful
+// sync.
+func (d *Daemon) zones() []*ConfigZone {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	zones := make([]*ConfigZone, 0, len(d.cfg.ZoneMap)+len(d.discovered))
+	for _, cz := range d.cfg.ZoneMap {
+		zones = append(zones, cz)
+	}
+	for _, cz := range d.discovered {
+		if d.cfg.ZoneMap[cz.Name] == nil {
+			zones = append(zones, cz)
+		}
+	}
+	return zones
+}
+
+// Status returns a copy of the daemon's current status.
+func (d *Daemon) Status() DaemonStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status
+}
+
+// Reload asks the daemon to re-read its config file before the next
+// run.  If a sync is in progress, it finishes using the old config.
+func (d *Daemon) Reload() {
+	select {
+	case d.reload <- struct{}{}:
+	default:
+	}
+}
+
+// triggerAll asks the daemon to sync every zone as soon as possible,
+// without waiting for the interval to expire.  Multiple triggers that
+// arrive while a sync is running result in a single additional run.
+func (d *Daemon) triggerAll() {
+	d.mu.Lock()
+	d.pendingAll = true
+	d.mu.Unlock()
+	d.wake()
+}
+
+// TriggerZones asks the daemon to write the named zones as soon as
+// possible.  Zones requested while a sync is running are merged and
+// written together in the next run.
+func (d *Daemon) TriggerZones(zones []string) {
+	if len(zones) == 0 {
+		return
+	}
+	d.mu.Lock()
+	for _, z := range zones {
+		d.pendingZone[z] = true
+	}
+	d.mu.Unlock()
+	d.wake()
+}
+
+func (d *Daemon) wake() {
+	select {
+	case d.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// takePending returns the options for a triggered run and clears the
+// pending requests.  `full` is true if every zone will be written.
+func (d *Daemon) takePending() (opts SyncOptions, full bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	full = d.pendingAll
+	if !full {
+		for z := range d.pendingZone {
+			opts.Zones = append(opts.Zones, z)
+		}
+		sort.Strings(opts.Zones)
+	}
+	d.pendingAll = false
+	d.pendingZone = make(map[string]bool)
+	return opts, full
+}
+
+// Run syncs immediately and then keeps syncing until ctx is
+// canceled.  Cancellation doesn't interrupt a sync that is already
+// running; Run waits for it to finish and then returns.
+func (d *Daemon) Run(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-d.reload:
+			d.reloadConfig()
+		case <-timer.C:
+			// A full sync satisfies any pending requests.
+			d.takePending()
+			d.runOnce(context.WithoutCancel(ctx), SyncOptions{})
+			timer.Reset(d.nextDelay())
+		case <-d.trigger:
+			opts, full := d.takePending()
+			if !full && len(opts.Zones) == 0 {
+				continue
+			}
+			d.runOnce(context.WithoutCancel(ctx), opts)
+
+			// Partial syncs don't delay the next periodic
+			// full sync.
+			if full {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(d.nextDelay())
+			}
+		}
+	}
+}
+
+// runOnce performs a single sync and updates the daemon's status.
+func (d *Daemon) runOnce(ctx context.Context, opts SyncOptions) {
+	cfg := d.Config()
+
+	start := time.Now()
+	result, err := d.sync(ctx, cfg, opts)
+	end := time.Now()
+
+	d.metrics.Observe(result, err)
+	if cfg.Metrics.Textfile != "" {
+		if err := d.metrics.WriteTextfile(cfg.Metrics.Textfile); err != nil {
+			log.Errorf("Failed to write metrics to %q: %v", cfg.Metrics.Textfile, err)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.status.Runs++
+	d.status.LastRun = end
+	d.status.LastError = err
+	if err != nil {
+		d.status.Failures++
+		log.Errorf("Sync failed after %v (%d consecutive failures): %v", end.Sub(start), d.status.Failures, err)
+	} else {
+		d.status.Failures = 0
+		d.status.LastSuccess = end
+		d.discovered = result.Discovered
+		log.Infof("Sync wrote %d zones with %d IP addresses in %v", result.Zones, result.Addresses, end.Sub(start))
+	}
+}
+
+// nextDelay computes how long to wait before the next run, and
+// records it in the daemon's status.
+func (d *Daemon) nextDelay() time.Duration {
+	cfg := d.Config()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	interval := parseDurationOr(cfg.Daemon.Interval, defaultInterval)
+	jitter := parseDurationOr(cfg.Daemon.Jitter, defaultJitter)
+	maxBackoff := parseDurationOr(cfg.Daemon.MaxBackoff, defaultMaxBackoff)
+
+	delay := backoff(interval, maxBackoff, d.status.Failures)
+	if jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(jitter)))
+	}
+	d.status.NextRun = time.Now().Add(delay)
+	return delay
+}
+
+// backoff returns the delay before the next run after `failures`
+// consecutive failures.  The delay doubles with each failure, but
+// never exceeds maxBackoff (or interval, if that's larger).
+func backoff(interval, maxBackoff time.Duration, failures int) time.Duration {
+	if maxBackoff < interval {
+		maxBackoff = interval
+	}
+	delay := interval
+	for i := 0; i < failures && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// Handler returns an http.Handler for the daemon's HTTP endpoints:
+// `/webhook` receives NetBox webhooks, `/metrics` serves Prometheus
+// metrics, and `/status` reports the daemon's status as JSON.
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/webhook", NewWebhookHandler(d))
+	mux.Handle("/metrics", d.metrics.Handler())
+	mux.HandleFunc("/status", d.serveStatus)
+	return mux
+}
+
+func (d *Daemon) serveStatus(w http.ResponseWriter, r *http.Request) {
+	status := d.Status()
+	lastError := ""
+	if status.LastError != nil {
+		lastError = status.LastError.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Runs        int       `json:"runs"`
+		Failures    int       `json:"failures"`
+		LastRun     time.Time `json:"last_run"`
+		LastSuccess time.Time `json:"last_success"`
+		LastError   string    `json:"last_error,omitempty"`
+		NextRun     time.Time `json:"next_run"`
+	}{status.Runs, status.Failures, status.LastRun, status.LastSuccess, lastError, status.NextRun})
+}
+
+// reloadConfig re-reads the daemon's config file.  If the new config
+// is invalid, the old config is kept.
+func (d *Daemon) reloadConfig() {
+	cfg, err := ParseConfig(d.configFile)
+	if err != nil {
+		log.Errorf("Failed to reload config from %q, keeping old config: %v", d.configFile, err)
+		return
+	}
+
+	d.mu.Lock()
+	d.cfg = cfg
+	d.mu.Unlock()
+	log.Infof("Reloaded config from %q", d.configFile)
+}
+
+// parseDurationOr parses s as a time.Duration, returning def if s is
+// empty or invalid.
+func parseDurationOr(s string, def time.Duration) time.Duration {
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		log.Warningf("Invalid duration %q, using %v: %v", s, def, err)
+		return def
+	}
+	return d
+}
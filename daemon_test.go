@@ -0,0 +1,167 @@
+package netbox2dns
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		interval, maxBackoff time.Duration
+		failures             int
+		want                 time.Duration
+	}{
+		{time.Minute, 30 * time.Minute, 0, time.Minute},
+		{time.Minute, 30 * time.Minute, 1, 2 * time.Minute},
+		{time.Minute, 30 * time.Minute, 3, 8 * time.Minute},
+		{time.Minute, 30 * time.Minute, 5, 30 * time.Minute},
+		{time.Minute, 30 * time.Minute, 500, 30 * time.Minute},
+		{time.Hour, 30 * time.Minute, 2, time.Hour},
+	}
+
+	for _, test := range tests {
+		got := backoff(test.interval, test.maxBackoff, test.failures)
+		if got != test.want {
+			t.Errorf("backoff(%v, %v, %d): got %v, want %v", test.interval, test.maxBackoff, test.failures, got, test.want)
+		}
+	}
+}
+
+// newTestDaemon returns a Daemon with a long interval that calls
+// syncFunc instead of talking to NetBox.
+func newTestDaemon(syncFunc func(ctx context.Context, cfg *Config, opts SyncOptions) (*SyncResult, error)) *Daemon {
+	cfg := &Config{}
+	cfg.Daemon.Interval = "1h"
+	cfg.Daemon.Jitter = "0s"
+	cfg.Daemon.MaxBackoff = "2h"
+
+	return &Daemon{
+		cfg:         cfg,
+		pendingZone: make(map[string]bool),
+		reload:      make(chan struct{}, 1),
+		trigger:     make(chan struct{}, 1),
+		metrics:     NewMetrics(),
+		sync:        syncFunc,
+	}
+}
+
+func TestDaemonNoConcurrentSyncs(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning, runs := 0, 0, 0
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+
+	d := newTestDaemon(func(ctx context.Context, cfg *Config, opts SyncOptions) (*SyncResult, error) {
+		mu.Lock()
+		running++
+		runs++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		started <- struct{}{}
+		<-release
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return &SyncResult{}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+
+	// Wait for the initial sync, then trigger several more while
+	// it's still running.  These should coalesce into one run.
+	<-started
+	for i := 0; i < 5; i++ {
+		d.triggerAll()
+	}
+	release <- struct{}{}
+
+	<-started
+	// Cancel while the second sync is running; Run should wait
+	// for it to finish.
+	cancel()
+	select {
+	case <-done:
+		t.Fatalf("Run() returned before the running sync finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release <- struct{}{}
+	<-done
+
+	if maxRunning != 1 {
+		t.Errorf("max concurrent syncs: got %d, want 1", maxRunning)
+	}
+	if runs != 2 {
+		t.Errorf("sync runs: got %d, want 2", runs)
+	}
+	if got := d.Status().Runs; got != 2 {
+		t.Errorf("Status().Runs: got %d, want 2", got)
+	}
+}
+
+func TestDaemonFailures(t *testing.T) {
+	fail := true
+	d := newTestDaemon(func(ctx context.Context, cfg *Config, opts SyncOptions) (*SyncResult, error) {
+		if fail {
+			return &SyncResult{}, errors.New("netbox is down")
+		}
+		return &SyncResult{}, nil
+	})
+
+	d.runOnce(context.Background(), SyncOptions{})
+	d.runOnce(context.Background(), SyncOptions{})
+	status := d.Status()
+	if status.Failures != 2 {
+		t.Errorf("Status().Failures: got %d, want 2", status.Failures)
+	}
+	if status.LastError == nil {
+		t.Errorf("Status().LastError: got nil, want error")
+	}
+	if got := d.nextDelay(); got != 2*time.Hour {
+		t.Errorf("nextDelay() after 2 failures: got %v, want 2h", got)
+	}
+
+	fail = false
+	d.runOnce(context.Background(), SyncOptions{})
+	status = d.Status()
+	if status.Failures != 0 {
+		t.Errorf("Status().Failures after success: got %d, want 0", status.Failures)
+	}
+	if status.LastSuccess.IsZero() {
+		t.Errorf("Status().LastSuccess is zero after success")
+	}
+	if got := d.nextDelay(); got != time.Hour {
+		t.Errorf("nextDelay() after success: got %v, want 1h", got)
+	}
+}
+
+func TestDaemonTriggerZones(t *testing.T) {
+	d := newTestDaemon(nil)
+
+	d.TriggerZones([]string{"example.com"})
+	d.TriggerZones([]string{"10.in-addr.arpa", "example.com"})
+	opts, full := d.takePending()
+	if full {
+		t.Errorf("takePending(): got full sync, want partial")
+	}
+	want := []string{"10.in-addr.arpa", "example.com"}
+	if !reflect.DeepEqual(opts.Zones, want) {
+		t.Errorf("takePending(): got zones %v, want %v", opts.Zones, want)
+	}
+
+	d.TriggerZones([]string{"example.com"})
+	d.triggerAll()
+	opts, full = d.takePending()
+	if !full || len(opts.Zones) != 0 {
+		t.Errorf("takePending() after triggerAll(): got full=%v zones=%v, want a full sync", full, opts.Zones)
+	}
+}
@@ -0,0 +1,148 @@
+package netbox2dns
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/scottlaird/netbox2dns/netboxlib"
+)
+
+// discoveryEnabled returns true if reverse zones should be discovered
+// from NetBox prefixes.
+func (c *Config) discoveryEnabled() bool {
+	r := c.Discovery.Reverse
+	return (r.Tag != "" || r.Role != "") && r.Zone != nil
+}
+
+// checkDiscovery checks the template used for discovered zones.
+func (c *Config) checkDiscovery() error {
+	if !c.discoveryEnabled() {
+		return nil
+	}
+	z := c.Discovery.Reverse.Zone
+	switch {
+	case z.Name != "" || z.Prefix != "":
+		return fmt.Errorf("discovery.reverse.zone can't have a name or prefix; they come from NetBox")
+	case !strings.Contains(z.Filename, "{{"):
+		return fmt.Errorf("discovery.reverse.zone.filename must be a template like \"{{.Name}}.zone\"")
+	}
+	return nil
+}
+
+// DiscoverZones returns every zone that Sync should write: the zones
+// in cfg, plus reverse zones for the NetBox prefixes selected by
+// `discovery.reverse`.  The second return value lists just the
+// discovered zones.  If discovery isn't enabled, cfg.ZoneMap is
+// returned without contacting NetBox.
+func DiscoverZones(cfg *Config, client *netboxlib.Client) (map[string]*ConfigZone, []*ConfigZone, error) {
+	if !cfg.discoveryEnabled() {
+		return cfg.ZoneMap, nil, nil
+	}
+
+	prefixes, err := client.GetNetboxPrefixes(netboxlib.PrefixQuery{
+		Tag:  cfg.Discovery.Reverse.Tag,
+		Role: cfg.Discovery.Reverse.Role,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to fetch prefixes from Netbox: %w", err)
+	}
+
+	discovered := discoverZones(cfg, prefixes)
+	zoneMap := make(map[string]*ConfigZone, len(cfg.ZoneMap)+len(discovered))
+	for name, cz := range cfg.ZoneMap {
+		zoneMap[name] = cz
+	}
+	for _, cz := range discovered {
+		zoneMap[cz.Name] = cz
+	}
+	return zoneMap, discovered, nil
+}
+
+// discoverZones returns the reverse zones for prefixes, sorted by
+// name.  Prefixes whose status isn't in `discovery.reverse.status`
+// are ignored, so deprecated or reserved prefixes don't get zones.
+// Zones that are already configured, or that are inside a configured
+// reverse zone, are skipped, since their addresses already have
+// reverse DNS.
+func discoverZones(cfg *Config, prefixes []netboxlib.IpamPrefix) []*ConfigZone {
+	var configured []netip.Prefix
+	for _, cz := range cfg.ZoneMap {
+		if p, ok := configuredPrefix(cz); ok {
+			configured = append(configured, p)
+		}
+	}
+
+	found := map[string]*ConfigZone{}
+	for _, p := range prefixes {
+		if !statusAllowed(cfg.Discovery.Reverse.Status, p.Status) {
+			log.V(1).Infof("Not discovering zone for %s; its status is %q", p.Prefix, p.Status)
+			continue
+		}
+		if covered(configured, p.Prefix) {
+			log.V(1).Infof("Not discovering zone for %s; it's already covered by a configured zone", p.Prefix)
+			continue
+		}
+
+		template := *cfg.Discovery.Reverse.Zone
+		template.Prefix = p.Prefix.Masked().String()
+		zones, err := template.expand(cfg.Defaults.Directory)
+		if err != nil {
+			log.Warningf("Unable to create reverse zone for NetBox prefix %s: %v", p.Prefix, err)
+			continue
+		}
+		for _, cz := range zones {
+			if cfg.ZoneMap[cz.Name] != nil || found[cz.Name] != nil {
+				continue
+			}
+			log.V(1).Infof("Discovered reverse zone %q for NetBox prefix %s", cz.Name, p.Prefix)
+			found[cz.Name] = cz
+		}
+	}
+
+	zones := make([]*ConfigZone, 0, len(found))
+	for _, cz := range found {
+		zones = append(zones, cz)
+	}
+	sort.Slice(zones, func(i, j int) bool {
+		return zones[i].Name < zones[j].Name
+	})
+	return zones
+}
+
+// configuredPrefix returns the prefix covered by a configured reverse
+// zone.
+func configuredPrefix(cz *ConfigZone) (netip.Prefix, bool) {
+	if cz.Prefix != "" {
+		p, err := netip.ParsePrefix(cz.Prefix)
+		return p.Masked(), err == nil
+	}
+	return ReverseZonePrefix(cz.Name)
+}
+
+// statusAllowed returns true if a prefix with the given NetBox
+// status should be used for discovery.  An empty list allows every
+// status.
+func statusAllowed(allowed []string, status string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, s := range allowed {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// covered returns true if p is inside any of prefixes.
+func covered(prefixes []netip.Prefix, p netip.Prefix) bool {
+	for _, c := range prefixes {
+		if c.Bits() <= p.Bits() && c.Contains(p.Addr()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package netbox2dns
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/scottlaird/netbox2dns/netboxlib"
+)
+
+func TestDiscoverZones(t *testing.T) {
+	cfg, err := ParseConfig("testdata/config10/conf.yaml")
+	if err != nil {
+		t.Fatalf("Unable to parse config: %v", err)
+	}
+	if !cfg.discoveryEnabled() {
+		t.Fatalf("discovery isn't enabled for config10")
+	}
+	if want := []string{"active"}; !reflect.DeepEqual(cfg.Discovery.Reverse.Status, want) {
+		t.Errorf("cfg.Discovery.Reverse.Status: got %q, want %q", cfg.Discovery.Reverse.Status, want)
+	}
+
+	prefixes := []netboxlib.IpamPrefix{
+		{Prefix: netip.MustParsePrefix("10.20.0.0/16"), Status: "active"},
+		{Prefix: netip.MustParsePrefix("192.0.2.0/24"), Status: "active"},
+		{Prefix: netip.MustParsePrefix("192.0.2.0/24"), Status: "active", VRF: "other"},
+		{Prefix: netip.MustParsePrefix("198.51.100.0/23"), Status: "active"},
+		{Prefix: netip.MustParsePrefix("2001:db8:100::/48"), Status: "active"},
+		{Prefix: netip.MustParsePrefix("203.0.113.0/24"), Status: "deprecated"},
+		{Prefix: netip.MustParsePrefix("2001:db8:200::/48"), Status: "reserved"},
+	}
+
+	var got []string
+	for _, cz := range discoverZones(cfg, prefixes) {
+		got = append(got, cz.Name+" "+cz.Filename)
+		if cz.TTL != 3600 || cz.Prefix == "" {
+			t.Errorf("discovered zone %q: got TTL %d and prefix %q, want 3600 and a prefix", cz.Name, cz.TTL, cz.Prefix)
+		}
+	}
+	want := []string{
+		"0.0.1.0.8.b.d.0.1.0.0.2.ip6.arpa rev/0.0.1.0.8.b.d.0.1.0.0.2.ip6.arpa.zone",
+		"100.51.198.in-addr.arpa rev/100.51.198.in-addr.arpa.zone",
+		"101.51.198.in-addr.arpa rev/101.51.198.in-addr.arpa.zone",
+		"2.0.192.in-addr.arpa rev/2.0.192.in-addr.arpa.zone",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("discoverZones(): got %v, want %v", got, want)
+	}
+
+	// Other statuses can be allowed explicitly.
+	cfg.Discovery.Reverse.Status = []string{"active", "deprecated"}
+	got = nil
+	for _, cz := range discoverZones(cfg, prefixes) {
+		got = append(got, cz.Name)
+	}
+	want = []string{
+		"0.0.1.0.8.b.d.0.1.0.0.2.ip6.arpa",
+		"100.51.198.in-addr.arpa",
+		"101.51.198.in-addr.arpa",
+		"113.0.203.in-addr.arpa",
+		"2.0.192.in-addr.arpa",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("discoverZones() with deprecated prefixes: got %v, want %v", got, want)
+	}
+}
+
+func TestCheckDiscovery(t *testing.T) {
+	cfg := &Config{}
+	cfg.Discovery.Reverse.Tag = "dns-reverse"
+	cfg.Discovery.Reverse.Zone = &ConfigZone{ZoneType: "zonefile", Filename: "rev.zone"}
+	if err := cfg.checkDiscovery(); err == nil {
+		t.Errorf("checkDiscovery() without a filename template succeeded, want error")
+	}
+
+	cfg.Discovery.Reverse.Zone = &ConfigZone{ZoneType: "zonefile", Name: "10.in-addr.arpa", Filename: "{{.Name}}.zone"}
+	if err := cfg.checkDiscovery(); err == nil {
+		t.Errorf("checkDiscovery() with a name succeeded, want error")
+	}
+
+	cfg.Discovery.Reverse.Zone = &ConfigZone{ZoneType: "zonefile", Filename: "{{.Name}}.zone"}
+	if err := cfg.checkDiscovery(); err != nil {
+		t.Errorf("checkDiscovery() returned an error: %v", err)
+	}
+}
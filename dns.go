@@ -6,16 +6,28 @@ import (
 )
 
 // DNSProvider is an interface to a DNS provider backend, such a ZoneFile.
+// Save returns how the zone's published contents changed.
 type DNSProvider interface {
 	WriteRecord(cz *ConfigZone, r *Record) error
-	Save(cz *ConfigZone) error
+	Save(cz *ConfigZone) (Changes, error)
+}
+
+// Changes describes how saving a zone changed its published
+// contents.  Providers that can't tell which records changed leave
+// Added and Removed at 0.
+type Changes struct {
+	Changed bool // True if the zone's contents changed
+	Added   int  // Number of records added
+	Removed int  // Number of records removed
+
+	Serial uint32 // The zone's new SOA serial, for full-mode zones
 }
 
 // NewDNSProvider creates a provider of the correct type for the described zone.
-func NewDNSProvider(ctx context.Context, cz *ConfigZone) (DNSProvider, error) {
+func NewDNSProvider(ctx context.Context, cfg *Config, cz *ConfigZone) (DNSProvider, error) {
 	switch cz.ZoneType {
 	case "zonefile":
-		return NewZoneFileDNS(ctx, cz)
+		return NewZoneFileDNS(ctx, cfg, cz)
 	default:
 		return nil, fmt.Errorf("Unknown DNS provider type %q", cz.ZoneType)
 	}
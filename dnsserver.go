@@ -0,0 +1,548 @@
+package netbox2dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/miekg/dns"
+	"github.com/scottlaird/netbox2dns/zonefile"
+)
+
+// ednsUDPSize is the UDP payload size advertised in responses to
+// queries that use EDNS0, and the largest UDP response sent even to
+// clients that advertise more.  It's the value recommended by DNS Flag
+// Day 2020, which avoids IP fragmentation.
+const ednsUDPSize = 1232
+
+// maxCNAMEChain limits how many CNAMEs are followed within a zone
+// when answering a query.
+const maxCNAMEChain = 8
+
+// DNSServer answers authoritative DNS queries from an in-memory copy
+// of the zones generated from NetBox, as `netbox2dns serve-dns`.  Its
+// Sync method rebuilds every zone and then swaps the new zones in all
+// at once, so queries never see a partially-updated zone.  Only zones
+// in "full" mode are served, since only they have SOA and NS records.
+// Secondaries can copy the zones with AXFR, or with IXFR, using the
+// changes between successive syncs.
+type DNSServer struct {
+	mu      sync.Mutex  // serializes Sync, and protects serials
+	serials *serialFile // From `dns_server.serial_file`, or nil
+	zones   atomic.Pointer[memZones]
+}
+
+// NewDNSServer creates a DNSServer with no zones.  It refuses every
+// query until Sync succeeds.
+func NewDNSServer() *DNSServer {
+	s := &DNSServer{}
+	s.zones.Store(&memZones{zones: map[string]*memZone{}, transfer: &transferConfig{}})
+	return s
+}
+
+// memZones is one generation of the zones served by a DNSServer.  It's
+// never modified once it's been stored.
+type memZones struct {
+	zones    map[string]*memZone // By lower-case, fully-qualified name
+	transfer *transferConfig
+}
+
+// memZone is a single zone served by a DNSServer.  It's never
+// modified once it's been built.
+type memZone struct {
+	name    string   // Lower-case and fully-qualified
+	soa     *dns.SOA // The zone's SOA, including its serial
+	records []dns.RR // Every record except the SOA, in canonical order
+
+	// names holds the zone's records by lower-case owner name and
+	// type, including the SOA.  Empty non-terminals, names that
+	// only exist because they have children, have empty maps.
+	names map[string]map[uint16][]dns.RR
+
+	// cuts are the names below the apex with NS records, where
+	// part of the namespace is delegated to another zone.
+	cuts map[string]bool
+
+	// history holds the changes that led to this version of the
+	// zone, oldest first, for IXFR.
+	history []ixfrDelta
+}
+
+// zoneFor returns the zone that name belongs in, or nil if it isn't
+// in any served zone.
+func (z *memZones) zoneFor(name string) *memZone {
+	name = strings.ToLower(dns.Fqdn(name))
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if zone := z.zones[name[off:]]; zone != nil {
+			return zone
+		}
+	}
+	return nil
+}
+
+// newMemZone builds a memZone from a zone's records.  Its SOA has
+// serial 0 until setSerial is called.
+func newMemZone(cz *ConfigZone, zone *Zone) (*memZone, error) {
+	if cz.SOA == nil {
+		return nil, fmt.Errorf("Zone %q is in full mode but has no SOA settings", cz.Name)
+	}
+	mz := &memZone{
+		name:  strings.ToLower(dns.Fqdn(cz.Name)),
+		soa:   zoneSOA(cz, 0),
+		names: map[string]map[uint16][]dns.RR{},
+		cuts:  map[string]bool{},
+	}
+
+	for _, r := range zone.Records {
+		for _, rd := range r.Rrdatas {
+			rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", r.Name, r.TTL, r.Type, rd))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s record for %q in zone %q: %w", r.Type, r.Name, cz.Name, err)
+			}
+			if rr == nil {
+				continue
+			}
+			mz.records = append(mz.records, rr)
+		}
+	}
+	sort.Slice(mz.records, func(i, j int) bool {
+		return lessRR(mz.records[i], mz.records[j])
+	})
+
+	mz.names[mz.name] = map[uint16][]dns.RR{dns.TypeSOA: {mz.soa}}
+	for _, rr := range mz.records {
+		name := strings.ToLower(rr.Header().Name)
+		if !dns.IsSubDomain(mz.name, name) {
+			return nil, fmt.Errorf("Record %q is outside of zone %q", rr.Header().Name, cz.Name)
+		}
+		mz.addName(name)
+		mz.names[name][rr.Header().Rrtype] = append(mz.names[name][rr.Header().Rrtype], rr)
+		if rr.Header().Rrtype == dns.TypeNS && name != mz.name {
+			mz.cuts[name] = true
+		}
+	}
+	if len(mz.names[mz.name][dns.TypeNS]) == 0 {
+		return nil, fmt.Errorf("Zone %q has no NS records", cz.Name)
+	}
+	return mz, nil
+}
+
+// addName adds name and each of its ancestors up to the zone's apex
+// to z.names, if they aren't already there.
+func (z *memZone) addName(name string) {
+	for n := name; z.names[n] == nil; n = parentName(n) {
+		z.names[n] = map[uint16][]dns.RR{}
+		if n == z.name {
+			break
+		}
+	}
+}
+
+// parentName returns the name one label above name.
+func parentName(name string) string {
+	off, end := dns.NextLabel(name, 0)
+	if end {
+		return "."
+	}
+	return name[off:]
+}
+
+// lessRR orders records by owner name, in the canonical order from
+// RFC 4034, then by type, then by rdata.
+func lessRR(a, b dns.RR) bool {
+	if c := zonefile.CompareNames(a.Header().Name, b.Header().Name); c != 0 {
+		return c < 0
+	}
+	if a.Header().Rrtype != b.Header().Rrtype {
+		return a.Header().Rrtype < b.Header().Rrtype
+	}
+	return a.String() < b.String()
+}
+
+// setSerial gives z a serial, and returns how it differs from prev,
+// the previous version of the same zone.  If neither the zone's
+// records nor its SOA settings have changed, it keeps prev's serial.
+// Otherwise, it picks the next serial using the zone's serial
+// strategy, and adds the change to prev's history, keeping the last
+// `history` changes.  The first version after a restart continues
+// from the serial in `saved`, so serials never go backwards.  Without
+// a serial file, only the "unixtime" strategy can guarantee that.
+func (z *memZone) setSerial(cz *ConfigZone, prev *memZone, saved *serialFile, history int, now time.Time) (Changes, error) {
+	if prev == nil {
+		if saved == nil && cz.SOA.Serial != zonefile.SerialUnixTime && cz.SOA.Serial != "" {
+			return Changes{}, fmt.Errorf("Zone %q uses the %q serial strategy, which needs dns_server.serial_file to keep serials from going backwards after a restart", cz.Name, cz.SOA.Serial)
+		}
+		last, hasLast := saved.last(z.name)
+		serial, err := zonefile.NextSerial(cz.SOA.Serial, last, hasLast, now)
+		if err != nil {
+			return Changes{}, err
+		}
+		z.soa.Serial = serial
+		return Changes{Changed: true, Added: len(z.records), Serial: serial}, nil
+	}
+
+	removed, added := diffRecords(prev.records, z.records)
+	changes := Changes{Changed: len(removed) > 0 || len(added) > 0, Added: len(added), Removed: len(removed)}
+	soa := *prev.soa
+	soa.Serial = 0
+	if soa.String() != z.soa.String() {
+		changes.Changed = true
+	}
+	if !changes.Changed {
+		z.soa.Serial = prev.soa.Serial
+		changes.Serial = prev.soa.Serial
+		return changes, nil
+	}
+	serial, err := zonefile.NextSerial(cz.SOA.Serial, prev.soa.Serial, true, now)
+	if err != nil {
+		return Changes{}, err
+	}
+	z.soa.Serial = serial
+	changes.Serial = serial
+
+	if history > 0 {
+		kept := prev.history
+		if len(kept) > history-1 {
+			kept = kept[len(kept)-(history-1):]
+		}
+		z.history = append(append([]ixfrDelta(nil), kept...), ixfrDelta{from: prev.soa, to: z.soa, removed: removed, added: added})
+	}
+	return changes, nil
+}
+
+// diffRecords returns the records that are in old but not new, and
+// the ones that are in new but not old, in the same order as they
+// appear in old and new.
+func diffRecords(old, new []dns.RR) (removed, added []dns.RR) {
+	counts := map[string]int{}
+	for _, rr := range new {
+		counts[rr.String()]++
+	}
+	for _, rr := range old {
+		key := rr.String()
+		if counts[key] > 0 {
+			counts[key]--
+		} else {
+			removed = append(removed, rr)
+		}
+	}
+
+	counts = map[string]int{}
+	for _, rr := range old {
+		counts[rr.String()]++
+	}
+	for _, rr := range new {
+		key := rr.String()
+		if counts[key] > 0 {
+			counts[key]--
+		} else {
+			added = append(added, rr)
+		}
+	}
+	return removed, added
+}
+
+// Sync fetches all IP addresses from NetBox and rebuilds every
+// full-mode zone in memory, in place of writing zone files.  It has
+// the same signature as Sync so that it can be used by Daemon.  Every
+// zone is always rebuilt, so opts is ignored.  If a zone can't be
+// built, its previous version is kept.  Secondaries listed in a
+// zone's `notify` are notified once a changed zone is being served.
+func (s *DNSServer) Sync(ctx context.Context, cfg *Config, opts SyncOptions) (*SyncResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &SyncResult{
+		Start:       time.Now(),
+		ZoneResults: make(map[string]*ZoneResult),
+	}
+	defer func() {
+		result.Duration = time.Since(result.Start)
+	}()
+
+	newZones, zoneMap, err := fetchZones(cfg, SyncOptions{}, result)
+	if err != nil {
+		return result, err
+	}
+
+	// The serial file is read once, and again if its name
+	// changes; after that, the copy in memory is kept up to date.
+	switch filename := cfg.DNSServer.SerialFile; {
+	case filename == "":
+		s.serials = nil
+	case s.serials == nil || s.serials.filename != filename:
+		s.serials, err = loadSerialFile(filename)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	var errs []error
+	transfer, err := newTransferConfig(cfg)
+	if err != nil {
+		// Invalid settings are left out, so they can only make
+		// the server stricter.
+		errs = append(errs, err)
+	}
+	old := s.zones.Load()
+	next := &memZones{zones: map[string]*memZone{}, transfer: transfer}
+	changed := map[string]Changes{}
+	for name, zone := range newZones.Zones {
+		cz := zoneMap[name]
+		if cz.Mode != "full" {
+			continue
+		}
+		key := strings.ToLower(dns.Fqdn(name))
+		zr := &ZoneResult{Records: make(map[string]int)}
+		result.ZoneResults[name] = zr
+		start := time.Now()
+		mz, changes, err := buildMemZone(cz, zone, zr, result, old.zones[key], s.serials, cfg.DNSServer.IXFRHistory)
+		zr.ApplyDuration = time.Since(start)
+		if err != nil {
+			zr.Err = err
+			errs = append(errs, err)
+			if prev := old.zones[key]; prev != nil {
+				log.Errorf("Serving the previous version of %q: %v", name, err)
+				next.zones[key] = prev
+			}
+			continue
+		}
+		zr.Changed, zr.Added, zr.Removed = changes.Changed, changes.Added, changes.Removed
+		result.Zones++
+		next.zones[key] = mz
+		if changes.Changed {
+			changed[name] = changes
+			log.Infof("Zone %q changed: serial %d, %d record(s) added, %d removed", name, changes.Serial, changes.Added, changes.Removed)
+		}
+	}
+	// Save the new serials before serving them, so a restart can
+	// never go back to a lower serial.
+	if s.serials != nil {
+		if err := s.serials.update(next); err != nil {
+			return result, fmt.Errorf("%w; still serving the previous zones", err)
+		}
+	}
+	s.zones.Store(next)
+
+	for name, changes := range changed {
+		result.ZoneResults[name].Notifies = notifyZone(ctx, zoneMap[name], changes, nil)
+	}
+	return result, errors.Join(errs...)
+}
+
+// buildMemZone prepares a zone's records, builds a memZone from them,
+// and gives it a serial, keeping `history` changes for IXFR.  If
+// nothing changed since prev, prev is returned, so unchanged zones
+// stay the same between generations.  New zones continue from their
+// serial in `saved`, if any.
+func buildMemZone(cz *ConfigZone, zone *Zone, zr *ZoneResult, result *SyncResult, prev *memZone, saved *serialFile, history int) (*memZone, Changes, error) {
+	if err := prepareZone(zone, zr, result); err != nil {
+		return nil, Changes{}, err
+	}
+	mz, err := newMemZone(cz, zone)
+	if err != nil {
+		return nil, Changes{}, err
+	}
+	changes, err := mz.setSerial(cz, prev, saved, history, time.Now())
+	if err != nil {
+		return nil, Changes{}, err
+	}
+	if prev != nil && !changes.Changed {
+		return prev, changes, nil
+	}
+	return mz, changes, nil
+}
+
+// ServeDNS answers a single DNS query.  It implements dns.Handler.
+func (s *DNSServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Compress = true
+
+	switch {
+	case r.Opcode != dns.OpcodeQuery:
+		m.Rcode = dns.RcodeNotImplemented
+	case len(r.Question) != 1:
+		m.Rcode = dns.RcodeFormatError
+	default:
+		q := r.Question[0]
+		gen := s.zones.Load()
+		zone := gen.zoneFor(q.Name)
+		switch {
+		case zone == nil || (q.Qclass != dns.ClassINET && q.Qclass != dns.ClassANY):
+			m.Rcode = dns.RcodeRefused
+		case q.Qtype == dns.TypeAXFR || q.Qtype == dns.TypeIXFR:
+			s.transfer(w, r, gen, zone)
+			return
+		default:
+			zone.answer(m, q.Name, q.Qtype)
+		}
+	}
+
+	size := dns.MinMsgSize
+	if opt := r.IsEdns0(); opt != nil {
+		size = max(min(int(opt.UDPSize()), ednsUDPSize), dns.MinMsgSize)
+		m.SetEdns0(ednsUDPSize, false)
+	}
+	if w.LocalAddr().Network() != "udp" {
+		size = dns.MaxMsgSize
+	}
+	m.Truncate(size)
+	signReply(w, r, m)
+
+	if err := w.WriteMsg(m); err != nil {
+		log.V(1).Infof("Unable to send DNS response to %v: %v", w.RemoteAddr(), err)
+	}
+}
+
+// answer fills in m's answer, authority, and additional sections for
+// a query for qname and qtype, which must be in z.
+func (z *memZone) answer(m *dns.Msg, qname string, qtype uint16) {
+	name := strings.ToLower(dns.Fqdn(qname))
+
+	if cut := z.cut(name); cut != "" && !(cut == name && qtype == dns.TypeDS) {
+		// The name has been delegated, so refer the client to
+		// the child zone's servers, with any glue we have.
+		m.Ns = z.names[cut][dns.TypeNS]
+		m.Extra = z.addresses(m.Ns, true)
+		return
+	}
+	m.Authoritative = true
+
+	for chain := 0; ; chain++ {
+		rrsets, owner := z.lookup(name)
+		if rrsets == nil {
+			m.Rcode = dns.RcodeNameError
+			m.Ns = []dns.RR{z.negativeSOA()}
+			return
+		}
+
+		var answer []dns.RR
+		switch {
+		case qtype == dns.TypeANY:
+			for _, t := range sortedTypes(rrsets) {
+				answer = append(answer, rrsets[t]...)
+			}
+		case len(rrsets[qtype]) > 0:
+			answer = rrsets[qtype]
+		case len(rrsets[dns.TypeCNAME]) > 0:
+			answer = rrsets[dns.TypeCNAME]
+		}
+		if len(answer) == 0 {
+			m.Ns = []dns.RR{z.negativeSOA()}
+			return
+		}
+		if owner != name {
+			answer = synthesize(answer, qname)
+		}
+		m.Answer = append(m.Answer, answer...)
+
+		// Follow CNAMEs that point elsewhere in this zone.
+		cname, ok := answer[0].(*dns.CNAME)
+		if !ok || qtype == dns.TypeCNAME || qtype == dns.TypeANY || chain >= maxCNAMEChain {
+			break
+		}
+		target := strings.ToLower(cname.Target)
+		if !dns.IsSubDomain(z.name, target) || z.cut(target) != "" {
+			break
+		}
+		name, qname = target, cname.Target
+	}
+	m.Extra = z.addresses(m.Answer, false)
+}
+
+// lookup returns the records for name, and the owner name they came
+// from.  If name doesn't exist, a matching wildcard is used, as RFC
+// 4592 describes.  If there's no wildcard either, lookup returns nil.
+func (z *memZone) lookup(name string) (map[uint16][]dns.RR, string) {
+	if rrsets := z.names[name]; rrsets != nil {
+		return rrsets, name
+	}
+	// Find the closest encloser: the longest existing ancestor.
+	encloser := name
+	for z.names[encloser] == nil && encloser != z.name {
+		encloser = parentName(encloser)
+	}
+	wildcard := "*." + encloser
+	if rrsets := z.names[wildcard]; rrsets != nil {
+		return rrsets, wildcard
+	}
+	return nil, ""
+}
+
+// cut returns the highest delegation point at or above name, or "" if
+// name hasn't been delegated.
+func (z *memZone) cut(name string) string {
+	cut := ""
+	for n := name; n != z.name && n != "."; n = parentName(n) {
+		if z.cuts[n] {
+			cut = n
+		}
+	}
+	return cut
+}
+
+// negativeSOA returns the SOA record for negative answers.  As RFC
+// 2308 says, its TTL is the lower of the SOA's TTL and its minimum.
+func (z *memZone) negativeSOA() dns.RR {
+	soa := dns.Copy(z.soa)
+	if soa.Header().Ttl > z.soa.Minttl {
+		soa.Header().Ttl = z.soa.Minttl
+	}
+	return soa
+}
+
+// addresses returns the A and AAAA records that this zone has for
+// the targets of the NS, MX, and SRV records in rrs.  Addresses below
+// a delegation are only included when glue is true.
+func (z *memZone) addresses(rrs []dns.RR, glue bool) []dns.RR {
+	var extra []dns.RR
+	seen := map[string]bool{}
+	for _, rr := range rrs {
+		var target string
+		switch rr := rr.(type) {
+		case *dns.NS:
+			target = rr.Ns
+		case *dns.MX:
+			target = rr.Mx
+		case *dns.SRV:
+			target = rr.Target
+		default:
+			continue
+		}
+		target = strings.ToLower(target)
+		if seen[target] || !dns.IsSubDomain(z.name, target) || (!glue && z.cut(target) != "") {
+			continue
+		}
+		seen[target] = true
+		extra = append(extra, z.names[target][dns.TypeA]...)
+		extra = append(extra, z.names[target][dns.TypeAAAA]...)
+	}
+	return extra
+}
+
+// synthesize copies wildcard records, giving them the queried name.
+func synthesize(rrs []dns.RR, name string) []dns.RR {
+	out := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		out[i] = dns.Copy(rr)
+		out[i].Header().Name = name
+	}
+	return out
+}
+
+// sortedTypes returns the record types in rrsets, in numeric order.
+func sortedTypes(rrsets map[uint16][]dns.RR) []uint16 {
+	types := make([]uint16, 0, len(rrsets))
+	for t := range rrsets {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
@@ -0,0 +1,310 @@
+package netbox2dns
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/scottlaird/netbox2dns/netboxlib"
+)
+
+var testServedZones = []*ConfigZone{
+	{
+		Name:        "example.com",
+		TTL:         300,
+		Mode:        "full",
+		Nameservers: []string{"ns1"},
+		SOA:         &ConfigSOA{MName: "ns1", RName: "hostmaster@example.com", Refresh: 3600, Retry: 600, Expire: 1209600, Minimum: 60, Serial: "increment"},
+		Records: []*ConfigRecord{
+			{Name: "www", Type: "CNAME", Target: "a"},
+			{Name: "ext", Type: "CNAME", Target: "www.example.net."},
+			{Name: "@", Type: "MX", Preference: 10, Target: "a"},
+			{Name: "*.wild", Type: "TXT", Text: "wildcard"},
+			{Name: "sub", Type: "NS", Target: "ns.sub"},
+		},
+	},
+	{
+		Name:        "10.in-addr.arpa",
+		TTL:         300,
+		Mode:        "full",
+		Nameservers: []string{"ns1.example.com."},
+		SOA:         &ConfigSOA{MName: "ns1.example.com.", RName: "hostmaster@example.com", Refresh: 3600, Retry: 600, Expire: 1209600, Minimum: 60, Serial: "increment"},
+	},
+}
+
+// newTestDNSServer returns a DNSServer that keeps its serials in
+// serialFile, as `dns_server.serial_file` would.
+func newTestDNSServer(t *testing.T, serialFile string) *DNSServer {
+	s := NewDNSServer()
+	sf, err := loadSerialFile(serialFile)
+	if err != nil {
+		t.Fatalf("loadSerialFile() returned an error: %v", err)
+	}
+	s.serials = sf
+	return s
+}
+
+// loadTestZones builds a generation of zones from addrs, as Sync would,
+// and starts serving it.  It returns the changes to each zone.
+func loadTestZones(t *testing.T, s *DNSServer, addrs []netboxlib.IpamIPAddress) map[string]Changes {
+	zones := NewZones()
+	for _, cz := range testServedZones {
+		zones.NewZone(cz)
+	}
+	if _, err := zones.AddAddrs(addrs); err != nil {
+		t.Fatalf("AddAddrs() returned an error: %v", err)
+	}
+
+	old := s.zones.Load()
+	next := &memZones{zones: map[string]*memZone{}, transfer: old.transfer}
+	changes := map[string]Changes{}
+	for _, cz := range testServedZones {
+		zr := &ZoneResult{Records: map[string]int{}}
+		mz, c, err := buildMemZone(cz, zones.Zones[cz.Name], zr, &SyncResult{}, old.zones[cz.Name+"."], s.serials, 10)
+		if err != nil {
+			t.Fatalf("buildMemZone(%q) returned an error: %v", cz.Name, err)
+		}
+		next.zones[mz.name] = mz
+		changes[cz.Name] = c
+	}
+	if err := s.serials.update(next); err != nil {
+		t.Fatalf("Unable to save serials: %v", err)
+	}
+	s.zones.Store(next)
+	return changes
+}
+
+// startDNSServer serves s on a local port, over both UDP and TCP.
+func startDNSServer(t *testing.T, s *DNSServer) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	for _, server := range []*dns.Server{{PacketConn: pc, Handler: s, TsigProvider: s}, {Listener: l, Handler: s, TsigProvider: s}} {
+		started := make(chan struct{})
+		server.NotifyStartedFunc = func() { close(started) }
+		go server.ActivateAndServe()
+		<-started
+		t.Cleanup(func() { server.Shutdown() })
+	}
+	return pc.LocalAddr().String()
+}
+
+func TestDNSServer(t *testing.T) {
+	s := newTestDNSServer(t, filepath.Join(t.TempDir(), "serials.json"))
+	addr := startDNSServer(t, s)
+	client := &dns.Client{Timeout: time.Second}
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		m := new(dns.Msg)
+		m.SetQuestion(name, qtype)
+		resp, _, err := client.Exchange(m, addr)
+		if err != nil {
+			t.Fatalf("Query for %s %s failed: %v", name, dns.TypeToString[qtype], err)
+		}
+		return resp
+	}
+
+	// Nothing is served until the first sync.
+	if resp := query("a.example.com.", dns.TypeA); resp.Rcode != dns.RcodeRefused {
+		t.Errorf("Query before loading zones: got %s, want REFUSED", dns.RcodeToString[resp.Rcode])
+	}
+
+	changes := loadTestZones(t, s, []netboxlib.IpamIPAddress{
+		{Address: netip.MustParseAddr("10.0.0.1"), DNSName: "a.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("2001:db8::1"), DNSName: "a.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("10.0.0.2"), DNSName: "ns1.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("10.0.0.3"), DNSName: "ns.sub.example.com", Status: "active"},
+	})
+	if c := changes["example.com"]; !c.Changed || c.Serial != 1 {
+		t.Errorf("First load of example.com: got %+v, want a change with serial 1", c)
+	}
+
+	tests := []struct {
+		name   string
+		qtype  uint16
+		rcode  int
+		answer []string
+		ns     int  // Number of authority records
+		aa     bool // Authoritative answer
+	}{
+		{"a.example.com.", dns.TypeA, dns.RcodeSuccess, []string{"a.example.com.\t300\tIN\tA\t10.0.0.1"}, 0, true},
+		{"A.Example.COM.", dns.TypeAAAA, dns.RcodeSuccess, []string{"a.example.com.\t300\tIN\tAAAA\t2001:db8::1"}, 0, true},
+		{"1.0.0.10.in-addr.arpa.", dns.TypePTR, dns.RcodeSuccess, []string{"1.0.0.10.in-addr.arpa.\t300\tIN\tPTR\ta.example.com."}, 0, true},
+		{"example.com.", dns.TypeNS, dns.RcodeSuccess, []string{"example.com.\t300\tIN\tNS\tns1.example.com."}, 0, true},
+		{"www.example.com.", dns.TypeA, dns.RcodeSuccess, []string{"www.example.com.\t300\tIN\tCNAME\ta.example.com.", "a.example.com.\t300\tIN\tA\t10.0.0.1"}, 0, true},
+		{"ext.example.com.", dns.TypeA, dns.RcodeSuccess, []string{"ext.example.com.\t300\tIN\tCNAME\twww.example.net."}, 0, true},
+		{"x.wild.example.com.", dns.TypeTXT, dns.RcodeSuccess, []string{"x.wild.example.com.\t300\tIN\tTXT\t\"wildcard\""}, 0, true},
+		{"a.example.com.", dns.TypeMX, dns.RcodeSuccess, nil, 1, true},
+		{"wild.example.com.", dns.TypeA, dns.RcodeSuccess, nil, 1, true},
+		{"missing.example.com.", dns.TypeA, dns.RcodeNameError, nil, 1, true},
+		{"host.sub.example.com.", dns.TypeA, dns.RcodeSuccess, nil, 1, false},
+		{"example.net.", dns.TypeA, dns.RcodeRefused, nil, 0, false},
+	}
+	for _, test := range tests {
+		resp := query(test.name, test.qtype)
+		var answer []string
+		for _, rr := range resp.Answer {
+			answer = append(answer, rr.String())
+		}
+		if resp.Rcode != test.rcode || resp.Authoritative != test.aa || len(resp.Ns) != test.ns || len(answer) != len(test.answer) {
+			t.Errorf("%s %s: got %s aa=%v answer=%q ns=%v, want %s aa=%v answer=%q and %d authority records",
+				test.name, dns.TypeToString[test.qtype], dns.RcodeToString[resp.Rcode], resp.Authoritative, answer, resp.Ns,
+				dns.RcodeToString[test.rcode], test.aa, test.answer, test.ns)
+			continue
+		}
+		for i := range answer {
+			if answer[i] != test.answer[i] {
+				t.Errorf("%s %s: answer %d is %q, want %q", test.name, dns.TypeToString[test.qtype], i, answer[i], test.answer[i])
+			}
+		}
+	}
+
+	// Negative answers carry the SOA, with the minimum as its TTL.
+	resp := query("missing.example.com.", dns.TypeA)
+	if soa, ok := resp.Ns[0].(*dns.SOA); !ok || soa.Hdr.Ttl != 60 || soa.Serial != 1 {
+		t.Errorf("NXDOMAIN authority: got %v, want the SOA with TTL 60 and serial 1", resp.Ns[0])
+	}
+	// Referrals include glue.
+	resp = query("host.sub.example.com.", dns.TypeA)
+	if len(resp.Extra) != 1 || resp.Extra[0].String() != "ns.sub.example.com.\t300\tIN\tA\t10.0.0.3" {
+		t.Errorf("Referral glue: got %v, want ns.sub.example.com's address", resp.Extra)
+	}
+	// MX answers include the target's addresses.
+	resp = query("example.com.", dns.TypeMX)
+	if len(resp.Answer) != 1 || len(resp.Extra) != 2 {
+		t.Errorf("MX query: got answer %v and additional %v, want one MX and two addresses", resp.Answer, resp.Extra)
+	}
+
+	// TCP works too.
+	client.Net = "tcp"
+	if resp := query("example.com.", dns.TypeSOA); len(resp.Answer) != 1 || resp.Answer[0].(*dns.SOA).Serial != 1 {
+		t.Errorf("SOA query over TCP: got %v, want serial 1", resp.Answer)
+	}
+	client.Net = "udp"
+
+	// A sync without changes keeps the same zone and serial.
+	before := s.zones.Load().zones["example.com."]
+	changes = loadTestZones(t, s, []netboxlib.IpamIPAddress{
+		{Address: netip.MustParseAddr("10.0.0.1"), DNSName: "a.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("2001:db8::1"), DNSName: "a.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("10.0.0.2"), DNSName: "ns1.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("10.0.0.3"), DNSName: "ns.sub.example.com", Status: "active"},
+	})
+	if c := changes["example.com"]; c.Changed || c.Serial != 1 || s.zones.Load().zones["example.com."] != before {
+		t.Errorf("Unchanged reload of example.com: got %+v, want no change with serial 1", c)
+	}
+
+	// Changes get a new serial.
+	changes = loadTestZones(t, s, []netboxlib.IpamIPAddress{
+		{Address: netip.MustParseAddr("10.0.0.9"), DNSName: "a.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("10.0.0.2"), DNSName: "ns1.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("10.0.0.3"), DNSName: "ns.sub.example.com", Status: "active"},
+	})
+	if c := changes["example.com"]; !c.Changed || c.Serial != 2 || c.Added != 1 || c.Removed != 2 {
+		t.Errorf("Changed reload of example.com: got %+v, want serial 2 with 1 added and 2 removed", c)
+	}
+	resp = query("a.example.com.", dns.TypeA)
+	if len(resp.Answer) != 1 || resp.Answer[0].(*dns.A).A.String() != "10.0.0.9" {
+		t.Errorf("Query after reload: got %v, want 10.0.0.9", resp.Answer)
+	}
+}
+
+func TestDNSServerSerials(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "serials.json")
+	addrs := []netboxlib.IpamIPAddress{
+		{Address: netip.MustParseAddr("10.0.0.1"), DNSName: "a.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("10.0.0.2"), DNSName: "ns1.example.com", Status: "active"},
+	}
+
+	s := newTestDNSServer(t, filename)
+	loadTestZones(t, s, addrs)
+	addrs[0].Address = netip.MustParseAddr("10.0.0.11")
+	if c := loadTestZones(t, s, addrs)["example.com"]; c.Serial != 2 {
+		t.Fatalf("Changed reload of example.com: got serial %d, want 2", c.Serial)
+	}
+
+	// After a restart, serials continue from the saved ones, even
+	// if nothing changed.
+	s = newTestDNSServer(t, filename)
+	if c := loadTestZones(t, s, addrs)["example.com"]; !c.Changed || c.Serial != 3 {
+		t.Errorf("First load after a restart: got %+v, want serial 3", c)
+	}
+	sf, err := loadSerialFile(filename)
+	if err != nil {
+		t.Fatalf("loadSerialFile() returned an error: %v", err)
+	}
+	if serial, ok := sf.last("example.com."); !ok || serial != 3 {
+		t.Errorf("Saved serial for example.com: got %d, %v; want 3", serial, ok)
+	}
+
+	// Without a serial file, only unixtime serials are allowed.
+	zones := NewZones()
+	cz := testServedZones[0]
+	zones.NewZone(cz)
+	if _, err := zones.AddAddrs(addrs); err != nil {
+		t.Fatalf("AddAddrs() returned an error: %v", err)
+	}
+	zr := &ZoneResult{Records: map[string]int{}}
+	if _, _, err := buildMemZone(cz, zones.Zones[cz.Name], zr, &SyncResult{}, nil, nil, 10); err == nil {
+		t.Errorf("buildMemZone() with increment serials and no serial file succeeded")
+	}
+
+	if err := os.WriteFile(filename, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSerialFile(filename); err == nil {
+		t.Errorf("loadSerialFile() of an invalid file succeeded")
+	}
+}
+
+func TestDNSServerTruncation(t *testing.T) {
+	s := newTestDNSServer(t, filepath.Join(t.TempDir(), "serials.json"))
+	addr := startDNSServer(t, s)
+
+	addrs := []netboxlib.IpamIPAddress{
+		{Address: netip.MustParseAddr("10.0.0.2"), DNSName: "ns1.example.com", Status: "active"},
+	}
+	for i := 1; i <= 200; i++ {
+		a := netip.AddrFrom4([4]byte{10, 1, byte(i / 256), byte(i % 256)})
+		addrs = append(addrs, netboxlib.IpamIPAddress{Address: a, DNSName: "big.example.com", Status: "active"})
+	}
+	loadTestZones(t, s, addrs)
+
+	// UDP responses are never larger than ednsUDPSize, even if the
+	// client asks for more.
+	for _, bufsize := range []uint16{0, 256, 1232, 4096} {
+		m := new(dns.Msg)
+		m.SetQuestion("big.example.com.", dns.TypeA)
+		if bufsize != 0 {
+			m.SetEdns0(bufsize, false)
+		}
+		want := max(min(int(bufsize), ednsUDPSize), dns.MinMsgSize)
+
+		resp, _, err := (&dns.Client{UDPSize: 65535, Timeout: time.Second}).Exchange(m, addr)
+		if err != nil {
+			t.Fatalf("Query with a %d byte buffer failed: %v", bufsize, err)
+		}
+		resp.Compress = true
+		if !resp.Truncated || resp.Len() > want {
+			t.Errorf("Query with a %d byte buffer: got %d bytes, truncated=%v; want at most %d bytes, truncated", bufsize, resp.Len(), resp.Truncated, want)
+		}
+	}
+
+	// TCP responses are complete.
+	m := new(dns.Msg)
+	m.SetQuestion("big.example.com.", dns.TypeA)
+	resp, _, err := (&dns.Client{Net: "tcp", Timeout: time.Second}).Exchange(m, addr)
+	if err != nil || resp.Truncated || len(resp.Answer) != 200 {
+		t.Errorf("Query over TCP: got %d answers, %v; want all 200", len(resp.Answer), err)
+	}
+}
@@ -0,0 +1,171 @@
+package netbox2dns
+
+import (
+	"fmt"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// filenameData is passed to the template in a zone's `filename`.
+type filenameData struct {
+	Name string // The zone's name, like "10.in-addr.arpa"; '/' is replaced with '-'
+	Kind string // "forward" or "reverse"
+	View string // The zone's `view`, or ""
+}
+
+// zoneKind returns "reverse" for reverse zones, and "forward" for
+// everything else.
+func zoneKind(name string) string {
+	name = strings.ToLower(name)
+	if strings.HasSuffix(name, "in-addr.arpa") || strings.HasSuffix(name, "ip6.arpa") {
+		return "reverse"
+	}
+	return "forward"
+}
+
+// expand returns the zones described by a zone's config.  Most zones
+// describe a single zone, and are returned as-is.  Zones defined by
+// `prefix` may need several reverse zones; each is returned with its
+// own name, prefix, and filename, expanded from the filename
+// template.  Relative filenames are placed in `dir`, if it's set.
+func (cz *ConfigZone) expand(dir string) ([]*ConfigZone, error) {
+	if err := cz.checkDelegations(); err != nil {
+		return nil, err
+	}
+
+	if cz.Prefix == "" {
+		if cz.Name == "" {
+			return nil, fmt.Errorf("Zone needs either a name or a prefix")
+		}
+		ez := *cz
+		filename, err := ez.expandFilename(dir)
+		if err != nil {
+			return nil, err
+		}
+		ez.Filename = filename
+		return []*ConfigZone{&ez}, nil
+	}
+
+	prefix, err := netip.ParsePrefix(cz.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid prefix for zone: %w", err)
+	}
+	prefixes := ReverseZonePrefixes(prefix)
+
+	var zones []*ConfigZone
+	for _, p := range prefixes {
+		name, err := ReverseZoneName(p, cz.ClasslessStyle)
+		if err != nil {
+			return nil, err
+		}
+
+		ez := *cz
+		ez.Prefix = p.String()
+		ez.Name = name
+		if cz.Name != "" {
+			if err := checkPrefixZoneName(cz.Name, name, prefix, len(prefixes)); err != nil {
+				return nil, err
+			}
+			ez.Name = cz.Name
+		}
+		ez.Filename, err = ez.expandFilename(dir)
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, &ez)
+	}
+
+	if len(zones) > 1 && zones[0].Filename == zones[1].Filename {
+		return nil, fmt.Errorf("Prefix %s needs %d zones, so its filename must be a template like \"{{.Name}}.zone\"", prefix, len(zones))
+	}
+	return zones, nil
+}
+
+// checkPrefixZoneName checks an explicit name for a zone defined by
+// prefix.  Only classless zones may be renamed, since there's no
+// standard naming convention for them; other reverse zones must use
+// the derived name.
+func checkPrefixZoneName(name, derived string, prefix netip.Prefix, zones int) error {
+	switch {
+	case zones > 1:
+		return fmt.Errorf("Prefix %s needs %d zones, so it can't have a name", prefix, zones)
+	case prefix.Addr().Is4() && prefix.Bits() > 24:
+		parent := derived[strings.Index(derived, ".")+1:]
+		if !strings.HasSuffix(name, "."+parent) {
+			return fmt.Errorf("Classless zone %q for %s must be inside %q", name, prefix, parent)
+		}
+	case name != derived:
+		return fmt.Errorf("Zone %q for prefix %s should be named %q", name, prefix, derived)
+	}
+	return nil
+}
+
+// checkDelegations checks that a zone's classless delegations are
+// valid, and inside the zone.
+func (cz *ConfigZone) checkDelegations() error {
+	for _, d := range cz.ClasslessDelegations {
+		prefix, err := netip.ParsePrefix(d.Prefix)
+		if err != nil {
+			return fmt.Errorf("Invalid prefix for classless delegation in %q: %w", cz.Name, err)
+		}
+		if _, err := ClasslessZoneName(prefix, d.Style); err != nil {
+			return err
+		}
+		if cz.Name != "" && !strings.HasSuffix(ReverseName(prefix.Addr()), "."+cz.Name+".") {
+			return fmt.Errorf("Classless delegation %s is not inside zone %q", prefix, cz.Name)
+		}
+	}
+	return nil
+}
+
+// expandFilename returns the zone's filename, expanding it as a
+// template if necessary.  Relative filenames are placed in `dir`.
+func (cz *ConfigZone) expandFilename(dir string) (string, error) {
+	filename := cz.Filename
+	if strings.Contains(filename, "{{") {
+		tmpl, err := template.New("filename").Option("missingkey=error").Parse(filename)
+		if err != nil {
+			return "", fmt.Errorf("Invalid filename template %q: %w", filename, err)
+		}
+		data := filenameData{
+			Name: strings.ReplaceAll(cz.Name, "/", "-"),
+			Kind: zoneKind(cz.Name),
+			View: cz.View,
+		}
+		var b strings.Builder
+		err = tmpl.Execute(&b, data)
+		if err != nil {
+			return "", fmt.Errorf("Unable to expand filename template %q: %w", filename, err)
+		}
+		filename = b.String()
+	}
+
+	if dir != "" && filename != "" && !filepath.IsAbs(filename) {
+		filename = filepath.Join(dir, filename)
+	}
+	return filename, nil
+}
+
+// expandZones replaces each zone in the config with the zones it
+// expands to, and rebuilds ZoneMap to match.
+func (c *Config) expandZones() error {
+	var zones []*ConfigZone
+	c.ZoneMap = make(map[string]*ConfigZone)
+	for _, cz := range c.Zones {
+		expanded, err := cz.expand(c.Defaults.Directory)
+		if err != nil {
+			return err
+		}
+		for _, ez := range expanded {
+			if _, ok := c.ZoneMap[ez.Name]; ok {
+				return fmt.Errorf("Zone %q is defined more than once", ez.Name)
+			}
+			c.ZoneMap[ez.Name] = ez
+		}
+		zones = append(zones, expanded...)
+	}
+	c.Zones = zones
+	return c.checkDiscovery()
+}
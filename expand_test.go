@@ -0,0 +1,64 @@
+package netbox2dns
+
+import (
+	"testing"
+)
+
+func TestDirectoryMode(t *testing.T) {
+	cfg, err := ParseConfig("testdata/config11/conf.yaml")
+	if err != nil {
+		t.Fatalf("Unable to parse config: %v", err)
+	}
+
+	want := map[string]string{
+		"example.com":                "/var/lib/netbox2dns/forward/example.com.zone",
+		"internal.example.com":       "/var/lib/netbox2dns/internal/internal.example.com.db",
+		"10.in-addr.arpa":            "/var/lib/netbox2dns/reverse/10.in-addr.arpa.zone",
+		"64/27.2.0.192.in-addr.arpa": "/var/lib/netbox2dns/reverse/64-27.2.0.192.in-addr.arpa.zone",
+		"example.org":                "/etc/dns/example.org.zone",
+	}
+	if len(cfg.ZoneMap) != len(want) {
+		t.Errorf("got %d zones, want %d", len(cfg.ZoneMap), len(want))
+	}
+	for name, filename := range want {
+		cz := cfg.ZoneMap[name]
+		if cz == nil {
+			t.Errorf("cfg.ZoneMap[%q] is missing", name)
+			continue
+		}
+		if cz.Filename != filename {
+			t.Errorf("zone %q: got filename %q, want %q", name, cz.Filename, filename)
+		}
+	}
+}
+
+func TestExpandFilename(t *testing.T) {
+	tests := []struct {
+		cz   ConfigZone
+		dir  string
+		want string
+	}{
+		{ConfigZone{Name: "example.com", Filename: "example.com.zone"}, "", "example.com.zone"},
+		{ConfigZone{Name: "example.com", Filename: "example.com.zone"}, "/srv/dns", "/srv/dns/example.com.zone"},
+		{ConfigZone{Name: "example.com", Filename: "/etc/dns/{{.Name}}"}, "/srv/dns", "/etc/dns/example.com"},
+		{ConfigZone{Name: "1.10.in-addr.arpa", Filename: "{{.Kind}}-{{.Name}}"}, "", "reverse-1.10.in-addr.arpa"},
+		{ConfigZone{Name: "example.com", View: "external", Filename: "{{.View}}/{{.Kind}}/{{.Name}}"}, "", "external/forward/example.com"},
+	}
+	for _, test := range tests {
+		got, err := test.cz.expandFilename(test.dir)
+		if err != nil {
+			t.Errorf("expandFilename(%q, %q) returned an error: %v", test.cz.Filename, test.dir, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("expandFilename(%q, %q): got %q, want %q", test.cz.Filename, test.dir, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{"{{.Name", "{{.Nope}}"} {
+		cz := &ConfigZone{Name: "example.com", Filename: bad}
+		if _, err := cz.expandFilename(""); err == nil {
+			t.Errorf("expandFilename(%q) succeeded, want error", bad)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package netbox2dns
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/scottlaird/netbox2dns/netboxlib"
+	"github.com/scottlaird/netbox2dns/zonefile"
+)
+
+// Explanation traces a single NetBox IP address through netbox2dns,
+// recording each decision that affects its DNS records.  It's used by
+// `netbox2dns explain` to answer "why doesn't this host resolve?"
+type Explanation struct {
+	Addr    netboxlib.IpamIPAddress
+	Steps   []ExplainStep
+	Records []*ExplainedRecord
+}
+
+// ExplainStep is a single check applied to an IP address.
+type ExplainStep struct {
+	OK   bool
+	Desc string
+}
+
+// ExplainedRecord describes one record generated for an IP address,
+// where it would be published, and whether it's already there.
+type ExplainedRecord struct {
+	Kind    string // "forward" or "reverse"
+	Record  *Record
+	Zone    *Zone    // The zone chosen for the record, or nil
+	Matches []string // Every zone that matched, longest first
+	InFile  string   // Whether the zone file already has the record
+}
+
+// Explain traces addr through the same checks as AddAddrs.  Unlike
+// AddAddrs, it doesn't modify any zones.  It also checks whether each
+// generated record is already in its zone's file.
+func (z *Zones) Explain(addr netboxlib.IpamIPAddress) *Explanation {
+	e := &Explanation{Addr: addr}
+
+	e.step(addr.DNSName != "", "has a DNS name (NetBox query filter dns_name__empty=false)")
+	e.step(!containsString(addr.Tags, netboxlib.ExcludeTag), fmt.Sprintf("not tagged %s (NetBox query filter tag__n=%s)", netboxlib.ExcludeTag, netboxlib.ExcludeTag))
+	e.step(addr.Status == "active", fmt.Sprintf("status is %q; only \"active\" addresses are published", addr.Status))
+	e.step(ValidHostname(addr.DNSName), fmt.Sprintf("DNS name %q is a valid hostname", addr.DNSName))
+
+	if reason, _ := addrSkipReason(addr); reason != "" {
+		return e
+	}
+
+	forward, reverse := addrRecords(addr)
+	for _, er := range []*ExplainedRecord{
+		{Kind: "forward", Record: forward},
+		{Kind: "reverse", Record: reverse},
+	} {
+		for _, m := range z.MatchingZones(er.Record.Name) {
+			er.Matches = append(er.Matches, m.Name)
+		}
+		er.Zone, er.Record.Name = z.ZoneForRecord(er.Record)
+		if er.Zone != nil && !containsString(er.Matches, er.Zone.Name) {
+			er.Matches = []string{er.Zone.Name}
+		}
+		if er.Zone != nil {
+			if er.Record.TTL == 0 {
+				er.Record.TTL = er.Zone.TTL
+			}
+			er.InFile = inZoneFile(er.Zone, er.Record)
+		}
+		e.Records = append(e.Records, er)
+	}
+
+	return e
+}
+
+func (e *Explanation) step(ok bool, desc string) {
+	e.Steps = append(e.Steps, ExplainStep{OK: ok, Desc: desc})
+}
+
+// inZoneFile reports whether the zone's current file contains r.
+func inZoneFile(zone *Zone, r *Record) string {
+	rrs, err := zonefile.Load(zone.Filename, zone.Name+".")
+	if os.IsNotExist(err) {
+		return fmt.Sprintf("no: %s does not exist", zone.Filename)
+	}
+	if err != nil {
+		return fmt.Sprintf("unknown: %v", err)
+	}
+
+	for _, rr := range rrs {
+		if !strings.EqualFold(rr.Name, r.Name) || rr.Type != r.Type {
+			continue
+		}
+		for _, rd := range rr.Rdata {
+			if strings.EqualFold(rd, r.Rrdatas[0]) {
+				return fmt.Sprintf("yes, in %s", zone.Filename)
+			}
+		}
+	}
+	return fmt.Sprintf("no, not in %s; it will be added by the next push", zone.Filename)
+}
+
+// Write prints the explanation in a human-readable format.
+func (e *Explanation) Write(w io.Writer) {
+	fmt.Fprintf(w, "%s (DNS name %q, status %q, tags %v)\n", e.Addr.Address, e.Addr.DNSName, e.Addr.Status, e.Addr.Tags)
+	for _, s := range e.Steps {
+		result := "ok  "
+		if !s.OK {
+			result = "FAIL"
+		}
+		fmt.Fprintf(w, "  [%s] %s\n", result, s.Desc)
+	}
+
+	if len(e.Records) == 0 {
+		fmt.Fprintf(w, "  => no records are generated for this address\n")
+		return
+	}
+
+	for _, er := range e.Records {
+		r := er.Record
+		fmt.Fprintf(w, "  %s record: %s %d IN %s %s\n", er.Kind, r.Name, r.TTL, r.Type, r.Rrdatas[0])
+		if er.Zone == nil && len(er.Matches) > 0 {
+			fmt.Fprintf(w, "    zone: none; %s delegates this address to a classless zone that isn't managed here, so this record is dropped\n", er.Matches[0])
+			continue
+		}
+		if er.Zone == nil {
+			fmt.Fprintf(w, "    zone: none; no configured zone is a suffix of %q, so this record is dropped\n", r.Name)
+			continue
+		}
+		if er.Zone.classless() {
+			fmt.Fprintf(w, "    zone: %s (classless zone for %s)\n", er.Zone.Name, er.Zone.Prefix)
+		} else if len(er.Matches) > 1 {
+			fmt.Fprintf(w, "    zone: %s (longest match among %s)\n", er.Zone.Name, strings.Join(er.Matches, ", "))
+		} else {
+			fmt.Fprintf(w, "    zone: %s (only matching zone)\n", er.Zone.Name)
+		}
+		fmt.Fprintf(w, "    in zone file: %s\n", er.InFile)
+	}
+}
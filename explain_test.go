@@ -0,0 +1,92 @@
+package netbox2dns
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottlaird/netbox2dns/netboxlib"
+)
+
+func TestExplain(t *testing.T) {
+	dir := t.TempDir()
+	fwdFile := filepath.Join(dir, "internal.example.com.zone")
+	err := os.WriteFile(fwdFile, []byte("a.internal.example.com. 300 IN A 10.0.0.1\n"), 0644)
+	if err != nil {
+		t.Fatalf("Unable to write zone file: %v", err)
+	}
+
+	z := NewZones()
+	z.NewZone(&ConfigZone{Name: "example.com", TTL: 300, Filename: filepath.Join(dir, "example.com.zone")})
+	z.NewZone(&ConfigZone{Name: "internal.example.com", TTL: 300, Filename: fwdFile})
+	z.NewZone(&ConfigZone{Name: "10.in-addr.arpa", TTL: 300, Filename: filepath.Join(dir, "10.zone")})
+
+	e := z.Explain(netboxlib.IpamIPAddress{
+		Address: netip.MustParseAddr("10.0.0.1"),
+		DNSName: "a.internal.example.com",
+		Status:  "active",
+	})
+
+	for _, s := range e.Steps {
+		if !s.OK {
+			t.Errorf("step %q failed, want ok", s.Desc)
+		}
+	}
+	if len(e.Records) != 2 {
+		t.Fatalf("len(e.Records): got %d, want 2", len(e.Records))
+	}
+
+	fwd := e.Records[0]
+	if fwd.Zone == nil || fwd.Zone.Name != "internal.example.com" {
+		t.Errorf("forward zone: got %v, want internal.example.com", fwd.Zone)
+	}
+	if len(fwd.Matches) != 2 || fwd.Matches[1] != "example.com" {
+		t.Errorf("forward matches: got %v, want [internal.example.com example.com]", fwd.Matches)
+	}
+	if !strings.HasPrefix(fwd.InFile, "yes") {
+		t.Errorf("forward InFile: got %q, want yes", fwd.InFile)
+	}
+
+	rev := e.Records[1]
+	if rev.Zone == nil || rev.Zone.Name != "10.in-addr.arpa" {
+		t.Errorf("reverse zone: got %v, want 10.in-addr.arpa", rev.Zone)
+	}
+	if !strings.HasPrefix(rev.InFile, "no") {
+		t.Errorf("reverse InFile: got %q, want no", rev.InFile)
+	}
+
+	// Explain must not modify the zones.
+	for _, zone := range z.Zones {
+		if len(zone.Records) != 0 {
+			t.Errorf("zone %q has %d records after Explain(), want 0", zone.Name, len(zone.Records))
+		}
+	}
+}
+
+func TestExplainSkipped(t *testing.T) {
+	z := NewZones()
+	z.NewZone(&ConfigZone{Name: "example.com", TTL: 300})
+
+	e := z.Explain(netboxlib.IpamIPAddress{
+		Address: netip.MustParseAddr("10.0.0.2"),
+		DNSName: "b.example.com",
+		Status:  "active",
+		Tags:    []string{netboxlib.ExcludeTag},
+	})
+
+	if len(e.Records) != 0 {
+		t.Errorf("excluded address generated %d records, want 0", len(e.Records))
+	}
+	if e.Steps[1].OK {
+		t.Errorf("exclusion step: got ok, want FAIL")
+	}
+
+	var buf bytes.Buffer
+	e.Write(&buf)
+	if !strings.Contains(buf.String(), "[FAIL] not tagged netbox2dns_exclude") {
+		t.Errorf("Write() output missing failed exclusion step:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,125 @@
+package netbox2dns
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// gitTimeout limits how long each git command may run.
+const gitTimeout = time.Minute
+
+// git runs a git command in the configured repository and returns
+// its output.
+func git(ctx context.Context, cfg *Config, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", cfg.Git.Repository}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME="+cfg.Git.AuthorName,
+		"GIT_AUTHOR_EMAIL="+cfg.Git.AuthorEmail,
+		"GIT_COMMITTER_NAME="+cfg.Git.AuthorName,
+		"GIT_COMMITTER_EMAIL="+cfg.Git.AuthorEmail,
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// commitFiles commits files to the configured git repository with the
+// given message, and returns the new commit's hash.  Files must be
+// inside the repository.  If none of the files differ from what's
+// already committed, no commit is made and "" is returned.
+func commitFiles(ctx context.Context, cfg *Config, files []string, message string) (string, error) {
+	var paths []string
+	for _, f := range files {
+		rel, err := repositoryPath(cfg.Git.Repository, f)
+		if err != nil {
+			return "", err
+		}
+		paths = append(paths, rel)
+	}
+
+	args := append([]string{"add", "--"}, paths...)
+	if _, err := git(ctx, cfg, args...); err != nil {
+		return "", err
+	}
+	args = append([]string{"diff", "--cached", "--name-only", "--"}, paths...)
+	staged, err := git(ctx, cfg, args...)
+	if err != nil {
+		return "", err
+	}
+	if staged == "" {
+		return "", nil
+	}
+
+	args = append([]string{"commit", "--quiet", "--no-verify", "-m", message, "--"}, paths...)
+	if _, err := git(ctx, cfg, args...); err != nil {
+		return "", err
+	}
+	return git(ctx, cfg, "rev-parse", "HEAD")
+}
+
+// repositoryPath returns filename's path relative to the git
+// repository repo, or an error if it's outside of it.
+func repositoryPath(repo, filename string) (string, error) {
+	absRepo, err := filepath.Abs(repo)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absRepo, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Zone file %q is outside of git repository %q", filename, repo)
+	}
+	return rel, nil
+}
+
+// commitZones commits the files of the zones that changed during a
+// sync to the configured git repository.  The commit message lists
+// the number of records added and removed in each zone.
+func commitZones(ctx context.Context, cfg *Config, zones map[string]*ConfigZone, results map[string]*ZoneResult) (string, error) {
+	var names []string
+	for name := range zones {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	sort.Strings(names)
+
+	var files []string
+	var b strings.Builder
+	fmt.Fprintf(&b, "Update %d zone(s) from NetBox at %s\n\n", len(names), cfg.Netbox.Host)
+	for _, name := range names {
+		zr := results[name]
+		fmt.Fprintf(&b, "%s: %d added, %d removed\n", name, zr.Added, zr.Removed)
+		files = append(files, zones[name].Filename)
+	}
+
+	hash, err := commitFiles(ctx, cfg, files, b.String())
+	if err != nil {
+		return "", fmt.Errorf("Unable to commit zone files: %w", err)
+	}
+	if hash != "" {
+		log.Infof("Committed %d zone file(s) to %s as %s", len(files), cfg.Git.Repository, hash)
+	}
+	return hash, nil
+}
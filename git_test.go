@@ -0,0 +1,77 @@
+package netbox2dns
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommitZones(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("git not found: %v", err)
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	cfg := &Config{}
+	cfg.Netbox.Host = "netbox.example.com"
+	cfg.Git.Repository = dir
+	cfg.Git.AuthorName = "netbox2dns"
+	cfg.Git.AuthorEmail = "netbox2dns@localhost"
+	if _, err := git(ctx, cfg, "init", "--quiet"); err != nil {
+		t.Fatalf("git init failed: %v", err)
+	}
+
+	zones := map[string]*ConfigZone{
+		"example.com":     {Name: "example.com", Filename: filepath.Join(dir, "example.com.zone")},
+		"10.in-addr.arpa": {Name: "10.in-addr.arpa", Filename: filepath.Join(dir, "reverse", "10.zone")},
+	}
+	results := map[string]*ZoneResult{
+		"example.com":     {Changed: true, Added: 2, Removed: 1},
+		"10.in-addr.arpa": {Changed: true, Added: 2},
+	}
+	os.Mkdir(filepath.Join(dir, "reverse"), 0755)
+	for _, cz := range zones {
+		if err := os.WriteFile(cz.Filename, []byte("; "+cz.Name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hash, err := commitZones(ctx, cfg, zones, results)
+	if err != nil {
+		t.Fatalf("commitZones() returned an error: %v", err)
+	}
+	head, err := git(ctx, cfg, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatalf("git rev-parse failed: %v", err)
+	}
+	if hash == "" || hash != head {
+		t.Errorf("commitZones() returned %q, want HEAD (%q)", hash, head)
+	}
+
+	message, err := git(ctx, cfg, "log", "-1", "--format=%an <%ae>%n%B")
+	if err != nil {
+		t.Fatalf("git log failed: %v", err)
+	}
+	want := "netbox2dns <netbox2dns@localhost>\n" +
+		"Update 2 zone(s) from NetBox at netbox.example.com\n\n" +
+		"10.in-addr.arpa: 2 added, 0 removed\n" +
+		"example.com: 2 added, 1 removed"
+	if message != want {
+		t.Errorf("commit message: got %q, want %q", message, want)
+	}
+
+	// Nothing changed, so there's nothing to commit.
+	hash, err = commitZones(ctx, cfg, zones, results)
+	if err != nil || hash != "" {
+		t.Errorf("commitZones() without changes: got %q, %v; want no commit", hash, err)
+	}
+
+	zones["example.net"] = &ConfigZone{Name: "example.net", Filename: filepath.Join(t.TempDir(), "example.net.zone")}
+	results["example.net"] = &ZoneResult{Changed: true}
+	if _, err := commitZones(ctx, cfg, zones, results); err == nil {
+		t.Errorf("commitZones() with a zone file outside of the repository didn't return an error")
+	}
+}
@@ -0,0 +1,116 @@
+package netbox2dns
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// defaultHookTimeout is used for hooks without a valid timeout.
+const defaultHookTimeout = 30 * time.Second
+
+// maxHookOutput is the most output kept from each hook.
+const maxHookOutput = 4096
+
+// HookResult describes a single run of an on_change hook.
+type HookResult struct {
+	Command  []string
+	Duration time.Duration
+	Output   string // Combined stdout and stderr, truncated to 4 KiB
+	Err      error
+}
+
+// RunHooks runs the on_change hooks for a zone whose contents
+// changed: first the zone's own hooks, and then the global ones.
+// Hooks run one at a time, and a failed hook doesn't stop the rest.
+//
+// Each hook gets the zone's details in its environment:
+// NETBOX2DNS_ZONE, NETBOX2DNS_FILENAME, NETBOX2DNS_VIEW,
+// NETBOX2DNS_ADDED, and NETBOX2DNS_REMOVED.
+func RunHooks(ctx context.Context, cfg *Config, cz *ConfigZone, changes Changes) []HookResult {
+	env := append(os.Environ(),
+		"NETBOX2DNS_ZONE="+cz.Name,
+		"NETBOX2DNS_FILENAME="+cz.Filename,
+		"NETBOX2DNS_VIEW="+cz.View,
+		"NETBOX2DNS_ADDED="+strconv.Itoa(changes.Added),
+		"NETBOX2DNS_REMOVED="+strconv.Itoa(changes.Removed),
+	)
+
+	var results []HookResult
+	for _, hooks := range [][]*ConfigHook{cz.OnChange, cfg.OnChange} {
+		for _, hook := range hooks {
+			r := runHook(ctx, hook, env)
+			if r.Err != nil {
+				log.Errorf("on_change hook %q for %q failed: %v: %s", r.Command, cz.Name, r.Err, r.Output)
+			} else {
+				log.Infof("Ran on_change hook %q for %q in %v", r.Command, cz.Name, r.Duration)
+			}
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+// runHook runs a single hook with the given environment, killing it
+// if it runs for longer than its timeout.
+func runHook(ctx context.Context, hook *ConfigHook, env []string) HookResult {
+	r := HookResult{Command: hook.Command}
+	if len(hook.Command) == 0 {
+		r.Err = fmt.Errorf("No command")
+		return r
+	}
+
+	timeout, err := time.ParseDuration(hook.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var output hookOutput
+	cmd := exec.CommandContext(ctx, hook.Command[0], hook.Command[1:]...)
+	cmd.Env = env
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Don't wait forever for children that keep stdout open after
+	// the hook is killed.
+	cmd.WaitDelay = 5 * time.Second
+
+	start := time.Now()
+	r.Err = cmd.Run()
+	r.Duration = time.Since(start)
+	if ctx.Err() == context.DeadlineExceeded {
+		r.Err = fmt.Errorf("Timed out after %v", timeout)
+	}
+
+	r.Output = strings.TrimSpace(output.buf.String())
+	if output.dropped > 0 {
+		r.Output += fmt.Sprintf("... (%d more bytes)", output.dropped)
+	}
+	return r
+}
+
+// hookOutput is an io.Writer that keeps the first maxHookOutput bytes
+// written to it and counts the rest, so a noisy hook can't use
+// unbounded memory.
+type hookOutput struct {
+	buf     bytes.Buffer
+	dropped int
+}
+
+func (o *hookOutput) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := maxHookOutput - o.buf.Len(); n > room {
+		o.dropped += n - room
+		p = p[:room]
+	}
+	o.buf.Write(p)
+	return n, nil
+}
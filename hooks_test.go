@@ -0,0 +1,58 @@
+package netbox2dns
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunHooks(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+
+	cfg := &Config{
+		OnChange: []*ConfigHook{
+			{Command: []string{"sh", "-c", "echo global >> " + out}},
+		},
+	}
+	cz := &ConfigZone{
+		Name:     "example.com",
+		Filename: "/etc/dns/example.com.zone",
+		OnChange: []*ConfigHook{
+			{Command: []string{"sh", "-c", `echo "$NETBOX2DNS_ZONE $NETBOX2DNS_FILENAME $NETBOX2DNS_ADDED $NETBOX2DNS_REMOVED" >> ` + out}},
+			{Command: []string{"sh", "-c", "echo broken; exit 3"}},
+			{Command: []string{"sleep", "10"}, Timeout: "100ms"},
+			{Command: []string{"sh", "-c", "head -c 10000 /dev/zero | tr '\\0' x"}},
+		},
+	}
+
+	results := RunHooks(context.Background(), cfg, cz, Changes{Changed: true, Added: 2, Removed: 1})
+	if len(results) != 5 {
+		t.Fatalf("RunHooks() returned %d results, want 5: %+v", len(results), results)
+	}
+	if results[0].Err != nil || results[3].Err != nil || results[4].Err != nil {
+		t.Errorf("RunHooks() returned errors for working hooks: %+v", results)
+	}
+	if results[1].Err == nil || results[1].Output != "broken" {
+		t.Errorf("Failing hook: got error %v and output %q, want an error and \"broken\"", results[1].Err, results[1].Output)
+	}
+	if results[2].Err == nil || !strings.Contains(results[2].Err.Error(), "Timed out") {
+		t.Errorf("Slow hook: got error %v, want a timeout", results[2].Err)
+	}
+
+	want := strings.Repeat("x", maxHookOutput) + "... (5904 more bytes)"
+	if results[3].Output != want {
+		t.Errorf("Noisy hook: got %d bytes of output, want %d x's and a count of the rest", len(results[3].Output), maxHookOutput)
+	}
+
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Unable to read hook output: %v", err)
+	}
+	want = "example.com /etc/dns/example.com.zone 2 1\nglobal\n"
+	if string(b) != want {
+		t.Errorf("Hook output: got %q, want %q", string(b), want)
+	}
+}
@@ -0,0 +1,142 @@
+package netbox2dns
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/scottlaird/netbox2dns/netboxlib"
+)
+
+// Names of the checks performed by Lint.
+const (
+	LintUnmatchedName   = "unmatched-name"
+	LintInvalidName     = "invalid-name"
+	LintDuplicateVRF    = "duplicate-name-across-vrfs"
+	LintUnmanagedRev    = "unmanaged-reverse-zone"
+	LintMissingA        = "missing-a"
+	LintMissingAAAA     = "missing-aaaa"
+	LintDeprecatedNamed = "deprecated-with-name"
+)
+
+// LintIssue is a single data quality problem found in NetBox.
+type LintIssue struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+	Address string `json:"address,omitempty"`
+	DNSName string `json:"dns_name,omitempty"`
+	VRF     string `json:"vrf,omitempty"`
+	Link    string `json:"link,omitempty"`
+}
+
+// Lint audits NetBox IP address data for problems that affect DNS,
+// without publishing anything.  It reports DNS names that don't
+// belong in any configured zone, invalid names, names used in more
+// than one VRF, addresses whose reverse zone isn't managed, names
+// that only have IPv4 or IPv6 addresses when `lint.dual_stack` is
+// set, and deprecated addresses that still have DNS names.
+func Lint(cfg *Config, zones *Zones, addrs []netboxlib.IpamIPAddress) []*LintIssue {
+	var issues []*LintIssue
+	add := func(check string, addr netboxlib.IpamIPAddress, format string, args ...interface{}) {
+		issues = append(issues, &LintIssue{
+			Check:   check,
+			Message: fmt.Sprintf(format, args...),
+			Address: addr.Address.String(),
+			DNSName: addr.DNSName,
+			VRF:     addr.VRF,
+			Link:    addr.WebURL(),
+		})
+	}
+
+	vrfs := map[string]map[string]bool{}
+	families := map[string]map[int]bool{}
+	byName := map[string][]netboxlib.IpamIPAddress{}
+
+	for _, addr := range addrs {
+		if addr.DNSName == "" || containsString(addr.Tags, netboxlib.ExcludeTag) {
+			continue
+		}
+		if addr.Status == "deprecated" {
+			add(LintDeprecatedNamed, addr, "deprecated address still has DNS name %q", addr.DNSName)
+			continue
+		}
+		if addr.Status != "active" {
+			continue
+		}
+		if !ValidHostname(addr.DNSName) {
+			add(LintInvalidName, addr, "%q is not a valid hostname", addr.DNSName)
+			continue
+		}
+
+		forward, reverse := addrRecords(addr)
+		if zones.ZoneFor(forward.Name) == nil {
+			add(LintUnmatchedName, addr, "%q does not match any configured zone", addr.DNSName)
+		}
+		if zone, _ := zones.ZoneForRecord(reverse); zone == nil {
+			add(LintUnmanagedRev, addr, "reverse zone for %s is not managed; %s will have no PTR record", addr.Address, reverse.Name)
+		}
+
+		name := strings.ToLower(addr.DNSName)
+		if vrfs[name] == nil {
+			vrfs[name] = map[string]bool{}
+			families[name] = map[int]bool{}
+		}
+		vrfs[name][addr.VRF] = true
+		if addr.Address.Is4() {
+			families[name][4] = true
+		} else {
+			families[name][6] = true
+		}
+		byName[name] = append(byName[name], addr)
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if len(vrfs[name]) > 1 {
+			var list []string
+			for v := range vrfs[name] {
+				if v == "" {
+					v = "global"
+				}
+				list = append(list, v)
+			}
+			sort.Strings(list)
+			for _, addr := range byName[name] {
+				add(LintDuplicateVRF, addr, "%q is used in %d VRFs (%s)", addr.DNSName, len(list), strings.Join(list, ", "))
+			}
+		}
+
+		if cfg.Lint.DualStack {
+			switch {
+			case !families[name][4]:
+				for _, addr := range byName[name] {
+					add(LintMissingA, addr, "%q has an AAAA record but no A record", addr.DNSName)
+				}
+			case !families[name][6]:
+				for _, addr := range byName[name] {
+					add(LintMissingAAAA, addr, "%q has an A record but no AAAA record", addr.DNSName)
+				}
+			}
+		}
+	}
+
+	return issues
+}
+
+// WriteLintText prints issues in a human-readable format.
+func WriteLintText(w io.Writer, issues []*LintIssue) {
+	for _, i := range issues {
+		vrf := ""
+		if i.VRF != "" {
+			vrf = " vrf=" + i.VRF
+		}
+		fmt.Fprintf(w, "%s: %s [%s%s] %s\n", i.Check, i.Message, i.Address, vrf, i.Link)
+	}
+	fmt.Fprintf(w, "%d issue(s) found\n", len(issues))
+}
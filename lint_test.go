@@ -0,0 +1,73 @@
+package netbox2dns
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/scottlaird/netbox2dns/netboxlib"
+)
+
+func TestLint(t *testing.T) {
+	cfg := &Config{}
+	cfg.Lint.DualStack = true
+
+	z := NewZones()
+	z.NewZone(&ConfigZone{Name: "example.com"})
+	z.NewZone(&ConfigZone{Name: "10.in-addr.arpa"})
+
+	addr := func(id int64, ip, name, status, vrf string) netboxlib.IpamIPAddress {
+		return netboxlib.IpamIPAddress{
+			ID:      id,
+			URL:     "https://netbox.example.com/api/ipam/ip-addresses/" + ip + "/",
+			Address: netip.MustParseAddr(ip),
+			DNSName: name,
+			Status:  status,
+			VRF:     vrf,
+		}
+	}
+
+	addrs := []netboxlib.IpamIPAddress{
+		// Dual-stacked and fine.
+		addr(1, "10.0.0.1", "ok.example.com", "active", ""),
+		addr(2, "fd00::1", "ok.example.com", "active", ""),
+		// No zone for example.org, and no reverse zone for 192.0.2.0/24.
+		addr(3, "192.0.2.1", "host.example.org", "active", ""),
+		// Invalid name.
+		addr(4, "10.0.0.4", "bad_-.example.com-", "active", ""),
+		// Same name in two VRFs.
+		addr(5, "10.0.0.5", "dup.example.com", "active", "prod"),
+		addr(6, "10.0.0.6", "dup.example.com", "active", "dev"),
+		// Deprecated with a name.
+		addr(7, "10.0.0.7", "old.example.com", "deprecated", ""),
+	}
+
+	issues := Lint(cfg, z, addrs)
+
+	counts := map[string]int{}
+	for _, i := range issues {
+		counts[i.Check]++
+	}
+
+	want := map[string]int{
+		LintUnmatchedName:   1,
+		LintUnmanagedRev:    2, // 192.0.2.1 and fd00::1
+		LintInvalidName:     1,
+		LintDuplicateVRF:    2,
+		LintDeprecatedNamed: 1,
+		LintMissingAAAA:     3, // host.example.org and both dup.example.com
+	}
+	for check, n := range want {
+		if counts[check] != n {
+			t.Errorf("Lint() %s issues: got %d, want %d", check, counts[check], n)
+		}
+	}
+	if counts[LintMissingA] != 0 {
+		t.Errorf("Lint() %s issues: got %d, want 0", LintMissingA, counts[LintMissingA])
+	}
+
+	for _, i := range issues {
+		if i.Check == LintDeprecatedNamed && i.Link != "https://netbox.example.com/ipam/ip-addresses/10.0.0.7/" {
+			t.Errorf("Lint() link: got %q, want NetBox web UI link", i.Link)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package netbox2dns
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds the Prometheus metrics describing sync runs.  Each
+// Metrics has its own registry, so the same metrics can be served by
+// the daemon on `/metrics` or written to a node_exporter textfile
+// collector file by `netbox2dns push`.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	syncRuns        *prometheus.CounterVec
+	syncDuration    prometheus.Gauge
+	lastSuccess     prometheus.Gauge
+	fetchDuration   prometheus.Gauge
+	fetchPages      prometheus.Gauge
+	addresses       prometheus.Gauge
+	addrs           *prometheus.GaugeVec
+	zoneRecords     *prometheus.GaugeVec
+	applyDuration   *prometheus.GaugeVec
+	applyErrors     *prometheus.CounterVec
+	lastZoneSuccess *prometheus.GaugeVec
+	hookRuns        *prometheus.CounterVec
+	notifies        *prometheus.CounterVec
+}
+
+// NewMetrics creates and registers all netbox2dns metrics.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		syncRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "netbox2dns_sync_runs_total",
+			Help: "Number of sync runs, by result.",
+		}, []string{"result"}),
+		syncDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "netbox2dns_sync_duration_seconds",
+			Help: "Duration of the most recent sync run.",
+		}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "netbox2dns_last_success_timestamp_seconds",
+			Help: "Unix time of the last sync run that completed without errors.",
+		}),
+		fetchDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "netbox2dns_netbox_fetch_duration_seconds",
+			Help: "Time spent fetching IP addresses from NetBox in the most recent sync.",
+		}),
+		fetchPages: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "netbox2dns_netbox_fetch_pages",
+			Help: "Number of NetBox API pages fetched in the most recent sync.",
+		}),
+		addresses: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "netbox2dns_netbox_addresses",
+			Help: "Number of IP addresses fetched from NetBox in the most recent sync.",
+		}),
+		addrs: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "netbox2dns_addresses",
+			Help: "Number of NetBox IP addresses in the most recent sync, by outcome (added, skipped, invalid, unmatched).",
+		}, []string{"outcome"}),
+		zoneRecords: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "netbox2dns_zone_records",
+			Help: "Number of records generated for each zone, by type.",
+		}, []string{"zone", "type"}),
+		applyDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "netbox2dns_zone_apply_duration_seconds",
+			Help: "Time spent writing each zone in the most recent sync that included it.",
+		}, []string{"zone"}),
+		applyErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "netbox2dns_zone_apply_errors_total",
+			Help: "Number of failed attempts to write each zone.",
+		}, []string{"zone"}),
+		lastZoneSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "netbox2dns_zone_last_success_timestamp_seconds",
+			Help: "Unix time that each zone was last written successfully.",
+		}, []string{"zone"}),
+		hookRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "netbox2dns_zone_hook_runs_total",
+			Help: "Number of on_change hooks run for each zone, by result.",
+		}, []string{"zone", "result"}),
+		notifies: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "netbox2dns_zone_notifies_total",
+			Help: "Number of DNS NOTIFY messages sent for each zone, by result.",
+		}, []string{"zone", "result"}),
+	}
+
+	m.registry.MustRegister(
+		m.syncRuns,
+		m.syncDuration,
+		m.lastSuccess,
+		m.fetchDuration,
+		m.fetchPages,
+		m.addresses,
+		m.addrs,
+		m.zoneRecords,
+		m.applyDuration,
+		m.applyErrors,
+		m.lastZoneSuccess,
+		m.hookRuns,
+		m.notifies,
+	)
+
+	return m
+}
+
+// Observe updates the metrics with the result of a sync run.  `err`
+// is the error returned by Sync.
+func (m *Metrics) Observe(result *SyncResult, err error) {
+	if err != nil {
+		m.syncRuns.WithLabelValues("failure").Inc()
+	} else {
+		m.syncRuns.WithLabelValues("success").Inc()
+	}
+	if result == nil {
+		return
+	}
+
+	end := result.Start.Add(result.Duration)
+	if err == nil {
+		m.lastSuccess.Set(float64(end.Unix()))
+	}
+	m.syncDuration.Set(result.Duration.Seconds())
+	m.fetchDuration.Set(result.FetchDuration.Seconds())
+	m.fetchPages.Set(float64(result.FetchPages))
+	m.addresses.Set(float64(result.Addresses))
+	m.addrs.WithLabelValues("added").Set(float64(result.AddrStats.Added))
+	m.addrs.WithLabelValues("skipped").Set(float64(result.AddrStats.Skipped))
+	m.addrs.WithLabelValues("invalid").Set(float64(len(result.AddrStats.Invalid)))
+	m.addrs.WithLabelValues("unmatched").Set(float64(len(result.AddrStats.Unmatched)))
+
+	for name, zr := range result.ZoneResults {
+		// Types that disappeared from a zone should read as 0,
+		// not keep their old value.
+		m.zoneRecords.DeletePartialMatch(prometheus.Labels{"zone": name})
+		for t, n := range zr.Records {
+			m.zoneRecords.WithLabelValues(name, t).Set(float64(n))
+		}
+		m.applyDuration.WithLabelValues(name).Set(zr.ApplyDuration.Seconds())
+		if zr.Err != nil {
+			m.applyErrors.WithLabelValues(name).Inc()
+		} else {
+			m.applyErrors.WithLabelValues(name).Add(0)
+			m.lastZoneSuccess.WithLabelValues(name).Set(float64(end.Unix()))
+		}
+		for _, h := range zr.Hooks {
+			if h.Err != nil {
+				m.hookRuns.WithLabelValues(name, "failure").Inc()
+			} else {
+				m.hookRuns.WithLabelValues(name, "success").Inc()
+			}
+		}
+		for _, n := range zr.Notifies {
+			if n.Err != nil {
+				m.notifies.WithLabelValues(name, "failure").Inc()
+			} else {
+				m.notifies.WithLabelValues(name, "success").Inc()
+			}
+		}
+	}
+}
+
+// Handler returns an http.Handler that serves the metrics in the
+// Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// WriteTextfile writes the metrics to filename in the format used by
+// node_exporter's textfile collector.  The file is replaced
+// atomically, so node_exporter never reads a partial file.
+func (m *Metrics) WriteTextfile(filename string) error {
+	return prometheus.WriteToTextfile(filename, m.registry)
+}
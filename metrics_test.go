@@ -0,0 +1,102 @@
+package netbox2dns
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsTextfile(t *testing.T) {
+	m := NewMetrics()
+
+	result := &SyncResult{
+		Start:         time.Unix(1700000000, 0),
+		Duration:      2 * time.Second,
+		Addresses:     3,
+		FetchDuration: time.Second,
+		FetchPages:    1,
+		AddrStats:     AddrStats{Added: 2, Skipped: 1},
+		ZoneResults: map[string]*ZoneResult{
+			"example.com":     {Records: map[string]int{"A": 2}},
+			"10.in-addr.arpa": {Records: map[string]int{"PTR": 2}, Err: errors.New("disk full")},
+		},
+	}
+	m.Observe(result, errors.New("disk full"))
+
+	filename := filepath.Join(t.TempDir(), "netbox2dns.prom")
+	err := m.WriteTextfile(filename)
+	if err != nil {
+		t.Fatalf("WriteTextfile() returned an error: %v", err)
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Unable to read metrics: %v", err)
+	}
+	text := string(b)
+
+	want := []string{
+		`netbox2dns_sync_runs_total{result="failure"} 1`,
+		`netbox2dns_netbox_fetch_pages 1`,
+		`netbox2dns_addresses{outcome="added"} 2`,
+		`netbox2dns_zone_records{type="A",zone="example.com"} 2`,
+		`netbox2dns_zone_records{type="PTR",zone="10.in-addr.arpa"} 2`,
+		`netbox2dns_zone_apply_errors_total{zone="10.in-addr.arpa"} 1`,
+		`netbox2dns_zone_apply_errors_total{zone="example.com"} 0`,
+		`netbox2dns_zone_last_success_timestamp_seconds{zone="example.com"} 1.700000002e+09`,
+	}
+	for _, w := range want {
+		if !strings.Contains(text, w+"\n") {
+			t.Errorf("metrics missing %q", w)
+		}
+	}
+	if strings.Contains(text, "netbox2dns_last_success_timestamp_seconds 1") {
+		t.Errorf("netbox2dns_last_success_timestamp_seconds set after a failed run")
+	}
+}
+
+func TestMetricsPartialSync(t *testing.T) {
+	m := NewMetrics()
+
+	stats := AddrStats{Added: 2, Unmatched: []string{"a.example.org.", "b.example.org."}}
+	m.Observe(&SyncResult{
+		Start:     time.Unix(1700000000, 0),
+		AddrStats: stats,
+		ZoneResults: map[string]*ZoneResult{
+			"example.com":     {Records: map[string]int{"A": 2}},
+			"10.in-addr.arpa": {Records: map[string]int{"PTR": 2}},
+		},
+	}, nil)
+
+	// A partial sync of one zone leaves the other zone's metrics
+	// alone, and still counts names that don't match any zone.
+	m.Observe(&SyncResult{
+		Start:     time.Unix(1700000060, 0),
+		AddrStats: stats,
+		ZoneResults: map[string]*ZoneResult{
+			"example.com": {Records: map[string]int{"A": 3}},
+		},
+	}, nil)
+
+	filename := filepath.Join(t.TempDir(), "netbox2dns.prom")
+	if err := m.WriteTextfile(filename); err != nil {
+		t.Fatalf("WriteTextfile() returned an error: %v", err)
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Unable to read metrics: %v", err)
+	}
+	text := string(b)
+
+	for _, w := range []string{
+		`netbox2dns_addresses{outcome="unmatched"} 2`,
+		`netbox2dns_zone_records{type="A",zone="example.com"} 3`,
+		`netbox2dns_zone_records{type="PTR",zone="10.in-addr.arpa"} 2`,
+	} {
+		if !strings.Contains(text, w+"\n") {
+			t.Errorf("metrics missing %q", w)
+		}
+	}
+}
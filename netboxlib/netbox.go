@@ -2,6 +2,7 @@ package netboxlib
 
 import (
 	"net/netip"
+	"strings"
 
 	httptransport "github.com/go-openapi/runtime/client"
 	"github.com/netbox-community/go-netbox/v3/netbox/client"
@@ -9,14 +10,44 @@ import (
 	"github.com/netbox-community/go-netbox/v3/netbox/models"
 )
 
+// ExcludeTag is the slug of the NetBox tag that keeps an IP address
+// out of DNS.
+const ExcludeTag = "netbox2dns_exclude"
+
 type IpamIPAddress struct {
+	ID      int64
+	URL     string // API URL of the IP address object
 	Address netip.Addr
 	DNSName string
 	Status  string
+	VRF     string   // VRF name, or "" for the global table
+	Tenant  string   // Tenant name, or "" if the address has no tenant
+	Tags    []string // Tag slugs
+}
+
+// WebURL returns the URL of the IP address in NetBox's web UI.
+func (a IpamIPAddress) WebURL() string {
+	return strings.Replace(a.URL, "/api/", "/", 1)
+}
+
+// IPAddressQuery narrows down the IP addresses fetched by
+// GetNetboxIPAddresses.  A nil query fetches every address that has
+// a DNS name and isn't tagged with ExcludeTag.
+type IPAddressQuery struct {
+	DNSName         string // Only addresses with this DNS name, ignoring case
+	Address         string // Only this address, with any prefix length
+	IncludeExcluded bool   // Also fetch addresses tagged with ExcludeTag
+	IncludeUnnamed  bool   // Also fetch addresses without a DNS name
 }
 
+// pageSize is the number of objects requested from NetBox at once.
+// NetBox's default MAX_PAGE_SIZE is 1000; larger values are silently
+// reduced to the server's maximum.
+const pageSize = 1000
+
 type Client struct {
-	api *client.NetBoxAPI
+	api      *client.NetBoxAPI
+	requests int
 }
 
 func NewClient(host, token string) *Client {
@@ -28,33 +59,63 @@ func NewClient(host, token string) *Client {
 	}
 }
 
-func (c *Client) GetNetboxIPAddresses(queryParameters []string) ([]IpamIPAddress, error) {
+// Requests returns the number of API requests that this client has
+// made to NetBox.
+func (c *Client) Requests() int {
+	return c.requests
+}
+
+func (c *Client) GetNetboxIPAddresses(query *IPAddressQuery) ([]IpamIPAddress, error) {
+	if query == nil {
+		query = &IPAddressQuery{}
+	}
+
 	param := ipam.NewIpamIPAddressesListParams()
 	var limit int64
-	limit = 0
+	limit = pageSize
 	param.SetLimit(&limit)
 
-	falseStrPtr := "false"
-	param.SetDNSNameEmpty(&falseStrPtr)
+	if !query.IncludeUnnamed {
+		falseStrPtr := "false"
+		param.SetDNSNameEmpty(&falseStrPtr)
+	}
 
-	tagn := "netbox2dns_exclude"
-	param.SetTagn(&tagn)
+	if !query.IncludeExcluded {
+		tagn := ExcludeTag
+		param.SetTagn(&tagn)
+	}
+	if query.DNSName != "" {
+		param.SetDNSNameIe(&query.DNSName)
+	}
+	if query.Address != "" {
+		param.SetAddress(&query.Address)
+	}
 
 	order := "address"
 	param.SetOrdering(&order)
 
-	res, err := c.api.Ipam.IpamIPAddressesList(param, nil)
-	if err != nil {
-		return nil, err
-	}
-
 	var iipAddresses []IpamIPAddress
-	for _, result := range res.Payload.Results {
-		iipAddress, err := covertModelsIPAddressToIpamIPAddress(*result)
+	var offset int64
+	for {
+		param.SetOffset(&offset)
+		res, err := c.api.Ipam.IpamIPAddressesList(param, nil)
+		c.requests++
 		if err != nil {
 			return nil, err
 		}
-		iipAddresses = append(iipAddresses, iipAddress)
+
+		for _, result := range res.Payload.Results {
+			iipAddress, err := covertModelsIPAddressToIpamIPAddress(*result)
+			if err != nil {
+				return nil, err
+			}
+			iipAddresses = append(iipAddresses, iipAddress)
+		}
+
+		offset += int64(len(res.Payload.Results))
+		if res.Payload.Next == nil || *res.Payload.Next == "" || len(res.Payload.Results) == 0 {
+			break
+		}
 	}
 	return iipAddresses, nil
 }
@@ -65,9 +126,122 @@ func covertModelsIPAddressToIpamIPAddress(m models.IPAddress) (IpamIPAddress, er
 	if err != nil {
 		return IpamIPAddress{}, err
 	}
+	var tags []string
+	for _, t := range m.Tags {
+		if t.Slug != nil {
+			tags = append(tags, *t.Slug)
+		}
+	}
+	vrf := ""
+	if m.Vrf != nil && m.Vrf.Name != nil {
+		vrf = *m.Vrf.Name
+	}
+	tenant := ""
+	if m.Tenant != nil && m.Tenant.Name != nil {
+		tenant = *m.Tenant.Name
+	}
 	return IpamIPAddress{
+		ID:      m.ID,
+		URL:     m.URL.String(),
 		Address: prefix.Addr(),
 		DNSName: m.DNSName,
 		Status:  *m.Status.Value,
+		VRF:     vrf,
+		Tenant:  tenant,
+		Tags:    tags,
+	}, nil
+}
+
+type IpamPrefix struct {
+	ID     int64
+	URL    string // API URL of the prefix object
+	Prefix netip.Prefix
+	Status string
+	VRF    string   // VRF name, or "" for the global table
+	Role   string   // Role slug, or "" if the prefix has no role
+	Tags   []string // Tag slugs
+}
+
+// PrefixQuery narrows down the prefixes fetched by
+// GetNetboxPrefixes.  Empty fields aren't used for filtering.
+type PrefixQuery struct {
+	Tag  string // Only prefixes with this tag slug
+	Role string // Only prefixes with this role slug
+}
+
+// GetNetboxPrefixes fetches the prefixes matching query from NetBox.
+func (c *Client) GetNetboxPrefixes(query PrefixQuery) ([]IpamPrefix, error) {
+	param := ipam.NewIpamPrefixesListParams()
+	var limit int64
+	limit = pageSize
+	param.SetLimit(&limit)
+
+	if query.Tag != "" {
+		param.SetTag(&query.Tag)
+	}
+	if query.Role != "" {
+		param.SetRole(&query.Role)
+	}
+
+	order := "prefix"
+	param.SetOrdering(&order)
+
+	var prefixes []IpamPrefix
+	var offset int64
+	for {
+		param.SetOffset(&offset)
+		res, err := c.api.Ipam.IpamPrefixesList(param, nil)
+		c.requests++
+		if err != nil {
+			return nil, err
+		}
+
+		for _, result := range res.Payload.Results {
+			prefix, err := convertModelsPrefixToIpamPrefix(*result)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix)
+		}
+
+		offset += int64(len(res.Payload.Results))
+		if res.Payload.Next == nil || *res.Payload.Next == "" || len(res.Payload.Results) == 0 {
+			break
+		}
+	}
+	return prefixes, nil
+}
+
+func convertModelsPrefixToIpamPrefix(m models.Prefix) (IpamPrefix, error) {
+	prefix, err := netip.ParsePrefix(*m.Prefix)
+	if err != nil {
+		return IpamPrefix{}, err
+	}
+	var tags []string
+	for _, t := range m.Tags {
+		if t.Slug != nil {
+			tags = append(tags, *t.Slug)
+		}
+	}
+	vrf := ""
+	if m.Vrf != nil && m.Vrf.Name != nil {
+		vrf = *m.Vrf.Name
+	}
+	role := ""
+	if m.Role != nil && m.Role.Slug != nil {
+		role = *m.Role.Slug
+	}
+	status := ""
+	if m.Status != nil && m.Status.Value != nil {
+		status = *m.Status.Value
+	}
+	return IpamPrefix{
+		ID:     m.ID,
+		URL:    m.URL.String(),
+		Prefix: prefix,
+		Status: status,
+		VRF:    vrf,
+		Role:   role,
+		Tags:   tags,
 	}, nil
 }
@@ -0,0 +1,148 @@
+package netbox2dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/miekg/dns"
+)
+
+// notifyTimeout is how long to wait for a response to each NOTIFY
+// message before sending it again.
+var notifyTimeout = 2 * time.Second
+
+// notifyAttempts is the number of times each NOTIFY is sent before
+// giving up on a secondary.
+const notifyAttempts = 3
+
+// NotifyResult describes the response to a NOTIFY sent to a single
+// secondary.
+type NotifyResult struct {
+	Target   string // The secondary's address, as host:port
+	Duration time.Duration
+	Rcode    string // The response code, like "NOERROR", if there was a response
+	Err      error
+}
+
+// SendNotifies sends RFC 1996 NOTIFY messages for a zone to each of
+// the zone's `notify` targets, so they fetch the new version without
+// waiting for the SOA refresh.  The messages include the zone's SOA
+// record with the new serial.  Targets are notified in parallel, and
+// results are returned in the same order as cz.Notify.
+func SendNotifies(ctx context.Context, cz *ConfigZone, serial uint32) []NotifyResult {
+	m := notifyMessage(cz, serial)
+
+	results := make([]NotifyResult, len(cz.Notify))
+	var wg sync.WaitGroup
+	for i, target := range cz.Notify {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			results[i] = sendNotify(ctx, m, notifyAddr(target))
+		}(i, target)
+	}
+	wg.Wait()
+
+	for _, r := range results {
+		if r.Err != nil {
+			log.Errorf("NOTIFY for %q to %s failed: %v", cz.Name, r.Target, r.Err)
+		} else {
+			log.Infof("Sent NOTIFY for %q to %s in %v", cz.Name, r.Target, r.Duration)
+		}
+	}
+	return results
+}
+
+// notifyMessage builds the NOTIFY message for a zone.
+func notifyMessage(cz *ConfigZone, serial uint32) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetNotify(dns.Fqdn(cz.Name))
+	if cz.SOA != nil {
+		m.Answer = []dns.RR{zoneSOA(cz, serial)}
+	}
+	return m
+}
+
+// zoneSOA returns the SOA record for a full-mode zone with the given
+// serial.
+func zoneSOA(cz *ConfigZone, serial uint32) *dns.SOA {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: dns.Fqdn(cz.Name), Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: uint32(cz.TTL)},
+		Ns:      absoluteName(cz.SOA.MName, cz.Name),
+		Mbox:    MailboxName(cz.SOA.RName, cz.Name),
+		Serial:  serial,
+		Refresh: cz.SOA.Refresh,
+		Retry:   cz.SOA.Retry,
+		Expire:  cz.SOA.Expire,
+		Minttl:  cz.SOA.Minimum,
+	}
+}
+
+// sendNotify sends m to addr over UDP, retrying if there's no
+// response.  Any response other than NOERROR is an error.
+func sendNotify(ctx context.Context, m *dns.Msg, addr string) NotifyResult {
+	r := NotifyResult{Target: addr}
+	client := &dns.Client{Net: "udp", Timeout: notifyTimeout}
+
+	start := time.Now()
+	var resp *dns.Msg
+	var err error
+	for attempt := 0; attempt < notifyAttempts; attempt++ {
+		resp, _, err = client.ExchangeContext(ctx, m, addr)
+		if err == nil || !isTimeout(err) || ctx.Err() != nil {
+			break
+		}
+	}
+	r.Duration = time.Since(start)
+
+	switch {
+	case err != nil:
+		r.Err = err
+	case resp.Opcode != dns.OpcodeNotify:
+		r.Err = fmt.Errorf("Response has opcode %s, want NOTIFY", dns.OpcodeToString[resp.Opcode])
+	default:
+		r.Rcode = dns.RcodeToString[resp.Rcode]
+		if resp.Rcode != dns.RcodeSuccess {
+			r.Err = fmt.Errorf("Secondary responded with %s", r.Rcode)
+		}
+	}
+	return r
+}
+
+// notifyAddr adds the default DNS port to a notify target that
+// doesn't have one.  Targets may be IPv4 or IPv6 addresses or
+// hostnames, optionally with a port, like "[2001:db8::1]:5353".
+func notifyAddr(target string) string {
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		return target
+	}
+	return net.JoinHostPort(target, "53")
+}
+
+// isTimeout returns true if err is a network timeout.
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// notifyZone sends NOTIFY messages for a full-mode zone that changed,
+// once its on_change hooks have run.  If a hook failed, then the
+// primary server may not have loaded the new zone yet, so secondaries
+// aren't notified.
+func notifyZone(ctx context.Context, cz *ConfigZone, changes Changes, hooks []HookResult) []NotifyResult {
+	if cz.Mode != "full" || len(cz.Notify) == 0 || !changes.Changed {
+		return nil
+	}
+	for _, h := range hooks {
+		if h.Err != nil {
+			log.Warningf("Not sending NOTIFY for %q, since on_change hook %q failed", cz.Name, h.Command)
+			return nil
+		}
+	}
+	return SendNotifies(ctx, cz, changes.Serial)
+}
@@ -0,0 +1,116 @@
+package netbox2dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// fakeSecondary answers NOTIFY messages on a local UDP port with
+// rcode, and sends each message it receives to got.
+func fakeSecondary(t *testing.T, rcode int, got chan<- *dns.Msg) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, dns.MaxMsgSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			m := new(dns.Msg)
+			if err := m.Unpack(buf[:n]); err != nil {
+				continue
+			}
+			got <- m
+			resp := new(dns.Msg)
+			resp.SetRcode(m, rcode)
+			b, _ := resp.Pack()
+			conn.WriteTo(b, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestSendNotifies(t *testing.T) {
+	got := make(chan *dns.Msg, 10)
+	ok := fakeSecondary(t, dns.RcodeSuccess, got)
+	refused := fakeSecondary(t, dns.RcodeRefused, got)
+
+	// Nothing listens on a port that was just closed.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	closed := conn.LocalAddr().String()
+	conn.Close()
+
+	old := notifyTimeout
+	notifyTimeout = 100 * time.Millisecond
+	defer func() { notifyTimeout = old }()
+
+	cz := &ConfigZone{
+		Name:   "example.com",
+		TTL:    300,
+		Mode:   "full",
+		SOA:    &ConfigSOA{MName: "ns1", RName: "hostmaster@example.com", Refresh: 3600, Retry: 600, Expire: 1209600, Minimum: 300},
+		Notify: []string{ok, refused, closed},
+	}
+	results := SendNotifies(context.Background(), cz, 2024010203)
+	if len(results) != 3 {
+		t.Fatalf("SendNotifies() returned %d results, want 3", len(results))
+	}
+	if results[0].Target != ok || results[0].Err != nil || results[0].Rcode != "NOERROR" {
+		t.Errorf("NOTIFY to working secondary: got %+v, want NOERROR", results[0])
+	}
+	if results[1].Err == nil || results[1].Rcode != "REFUSED" {
+		t.Errorf("NOTIFY to refusing secondary: got %+v, want a REFUSED error", results[1])
+	}
+	if results[2].Err == nil {
+		t.Errorf("NOTIFY to missing secondary: got %+v, want an error", results[2])
+	}
+
+	m := <-got
+	if m.Opcode != dns.OpcodeNotify || !m.Authoritative || len(m.Question) != 1 || m.Question[0].Name != "example.com." || m.Question[0].Qtype != dns.TypeSOA {
+		t.Errorf("NOTIFY message wrong: %v", m)
+	}
+	if len(m.Answer) != 1 {
+		t.Fatalf("NOTIFY message has %d answers, want the SOA", len(m.Answer))
+	}
+	soa, isSOA := m.Answer[0].(*dns.SOA)
+	if !isSOA || soa.Serial != 2024010203 || soa.Ns != "ns1.example.com." || soa.Mbox != "hostmaster.example.com." {
+		t.Errorf("NOTIFY message's SOA wrong: %v", m.Answer[0])
+	}
+
+	// Secondaries aren't notified if a hook failed.
+	changes := Changes{Changed: true, Serial: 2024010204}
+	if r := notifyZone(context.Background(), cz, changes, []HookResult{{Err: context.Canceled}}); r != nil {
+		t.Errorf("notifyZone() after a failed hook: got %+v, want nil", r)
+	}
+	cz.Notify = []string{ok}
+	if r := notifyZone(context.Background(), cz, changes, []HookResult{{}}); len(r) != 1 || r[0].Err != nil {
+		t.Errorf("notifyZone(): got %+v, want one successful NOTIFY", r)
+	}
+}
+
+func TestNotifyAddr(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.53":          "192.0.2.53:53",
+		"192.0.2.53:5353":     "192.0.2.53:5353",
+		"2001:db8::53":        "[2001:db8::53]:53",
+		"[2001:db8::53]:5353": "[2001:db8::53]:5353",
+		"ns2.example.net":     "ns2.example.net:53",
+	}
+	for target, want := range tests {
+		if got := notifyAddr(target); got != want {
+			t.Errorf("notifyAddr(%q): got %q, want %q", target, got, want)
+		}
+	}
+}
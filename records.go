@@ -1,7 +1,12 @@
 package netbox2dns
 
 import (
+	"fmt"
+	"net/netip"
+	"strconv"
 	"strings"
+
+	"github.com/scottlaird/netbox2dns/netboxlib"
 )
 
 // Record describes a DNS record, like 'foo.example.com IN AAAA 1:2::3:4'.
@@ -10,6 +15,39 @@ type Record struct {
 	Type    string
 	TTL     int64
 	Rrdatas []string
+
+	Addr netip.Addr // For PTR records, the address they describe
+
+	// Source is the NetBox IP address that produced the record,
+	// or nil for records that didn't come from NetBox.
+	Source *netboxlib.IpamIPAddress
+}
+
+// Provenance describes the NetBox object that produced the record,
+// like "netbox ipam/ip-addresses/1234 vrf=prod", for use in zone
+// file comments.  It returns "" for records that didn't come from
+// NetBox.
+func (r *Record) Provenance() string {
+	if r.Source == nil {
+		return ""
+	}
+	str := fmt.Sprintf("netbox ipam/ip-addresses/%d", r.Source.ID)
+	if r.Source.VRF != "" {
+		str += " vrf=" + provenanceValue(r.Source.VRF)
+	}
+	if r.Source.Tenant != "" {
+		str += " tenant=" + provenanceValue(r.Source.Tenant)
+	}
+	return str
+}
+
+// provenanceValue quotes s if it wouldn't otherwise be a single
+// word.
+func provenanceValue(s string) string {
+	if strings.ContainsAny(s, " \t\"=") {
+		return strconv.Quote(s)
+	}
+	return s
 }
 
 // NameNoDot returns the name of a record with no trailing dot.
@@ -21,3 +59,113 @@ func (r *Record) NameNoDot() string {
 func (r *Record) RrdataNoDot() string {
 	return strings.TrimRight(r.Rrdatas[0], ".")
 }
+
+// ValidHostname returns true if name can be published as a DNS owner
+// name.  Names may have a trailing dot.  Labels are limited to
+// letters, digits, hyphens, and underscores, and may not start or end
+// with a hyphen; a leading `*` label is allowed for wildcards.
+func ValidHostname(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) == 0 || len(name) > 253 {
+		return false
+	}
+
+	for i, label := range strings.Split(name, ".") {
+		if label == "*" && i == 0 {
+			continue
+		}
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// StaticRecord converts a record from the config into a Record in
+// the zone named `zone`.
+func StaticRecord(zone string, cr *ConfigRecord) (*Record, error) {
+	name := absoluteName(cr.Name, zone)
+	if name != zone+"." && !strings.HasSuffix(name, "."+zone+".") {
+		return nil, fmt.Errorf("Static record %q is not inside zone %q", cr.Name, zone)
+	}
+
+	r := &Record{
+		Name: name,
+		Type: cr.Type,
+		TTL:  cr.TTL,
+	}
+
+	switch cr.Type {
+	case "CNAME", "NS":
+		r.Rrdatas = []string{absoluteName(cr.Target, zone)}
+	case "MX":
+		r.Rrdatas = []string{fmt.Sprintf("%d %s", cr.Preference, absoluteName(cr.Target, zone))}
+	case "SRV":
+		r.Rrdatas = []string{fmt.Sprintf("%d %d %d %s", cr.Priority, cr.Weight, cr.Port, absoluteName(cr.Target, zone))}
+	case "TXT":
+		r.Rrdatas = []string{quoteTXT(cr.Text)}
+	case "CAA":
+		r.Rrdatas = []string{fmt.Sprintf("%d %s %s", cr.Flags, cr.Tag, quoteString(cr.Value))}
+	default:
+		return nil, fmt.Errorf("Unsupported static record type %q for %q", cr.Type, cr.Name)
+	}
+	return r, nil
+}
+
+// absoluteName makes name fully-qualified, treating names without a
+// trailing dot as relative to zone, like BIND does.
+func absoluteName(name, zone string) string {
+	switch {
+	case name == "@":
+		return zone + "."
+	case name == ".":
+		return "."
+	case strings.HasSuffix(name, "."):
+		return name
+	default:
+		return name + "." + zone + "."
+	}
+}
+
+// quoteString returns s as a quoted zone file string.
+func quoteString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// quoteTXT returns s as one or more quoted strings.  Each string in a
+// TXT record is limited to 255 bytes, so longer text is split.
+func quoteTXT(s string) string {
+	var parts []string
+	for len(s) > 255 {
+		parts = append(parts, quoteString(s[:255]))
+		s = s[255:]
+	}
+	parts = append(parts, quoteString(s))
+	return strings.Join(parts, " ")
+}
+
+// MailboxName converts an email address like `hostmaster@example.com`
+// into the domain name form used in SOA records,
+// `hostmaster.example.com.`.  Dots in the local part are escaped.
+// Names that aren't email addresses are made absolute relative to
+// zone.
+func MailboxName(mailbox, zone string) string {
+	local, domain, ok := strings.Cut(mailbox, "@")
+	if !ok {
+		return absoluteName(mailbox, zone)
+	}
+	local = strings.ReplaceAll(local, ".", `\.`)
+	return local + "." + strings.TrimSuffix(domain, ".") + "."
+}
@@ -0,0 +1,146 @@
+package netbox2dns
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+)
+
+// Report is a machine-readable summary of a sync run, written by
+// `netbox2dns push --report`.  It's meant for orchestration tools that
+// need to alert on partial failures.
+type Report struct {
+	Start           time.Time              `json:"start"`
+	DurationSeconds float64                `json:"duration_seconds"`
+	NetboxHost      string                 `json:"netbox_host"`
+	Success         bool                   `json:"success"`
+	Error           string                 `json:"error,omitempty"`
+	Addresses       int                    `json:"addresses"`
+	Skipped         int                    `json:"skipped"`
+	UnmatchedNames  []string               `json:"unmatched_names"`
+	InvalidNames    []string               `json:"invalid_names"`
+	Conflicts       []Conflict             `json:"conflicts"`
+	Zones           map[string]*ZoneReport `json:"zones"`
+	GitCommit       string                 `json:"git_commit,omitempty"`
+}
+
+// ZoneReport is the part of a Report that describes a single zone.
+type ZoneReport struct {
+	RecordsWritten int             `json:"records_written"`
+	RecordErrors   int             `json:"record_errors"`
+	Records        map[string]int  `json:"records"`
+	Changed        bool            `json:"changed"`
+	Added          int             `json:"added"`
+	Removed        int             `json:"removed"`
+	Hooks          []*HookReport   `json:"hooks,omitempty"`
+	Notifies       []*NotifyReport `json:"notifies,omitempty"`
+	Error          string          `json:"error,omitempty"`
+}
+
+// HookReport is the part of a ZoneReport that describes a single
+// on_change hook.
+type HookReport struct {
+	Command         []string `json:"command"`
+	DurationSeconds float64  `json:"duration_seconds"`
+	Output          string   `json:"output,omitempty"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// NotifyReport is the part of a ZoneReport that describes the
+// response to a single NOTIFY message.
+type NotifyReport struct {
+	Target          string  `json:"target"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Rcode           string  `json:"rcode,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// NewReport creates a Report from the results of Sync.
+func NewReport(cfg *Config, result *SyncResult, err error) *Report {
+	r := &Report{
+		NetboxHost:     cfg.Netbox.Host,
+		Success:        err == nil,
+		UnmatchedNames: []string{},
+		InvalidNames:   []string{},
+		Conflicts:      []Conflict{},
+		Zones:          map[string]*ZoneReport{},
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if result == nil {
+		return r
+	}
+
+	r.Start = result.Start
+	r.DurationSeconds = result.Duration.Seconds()
+	r.Addresses = result.Addresses
+	r.GitCommit = result.GitCommit
+	r.Skipped = result.AddrStats.Skipped
+	r.UnmatchedNames = append(r.UnmatchedNames, result.AddrStats.Unmatched...)
+	r.InvalidNames = append(r.InvalidNames, result.AddrStats.Invalid...)
+	r.Conflicts = append(r.Conflicts, result.Conflicts...)
+	sort.Strings(r.UnmatchedNames)
+	sort.Strings(r.InvalidNames)
+	sort.Slice(r.Conflicts, func(i, j int) bool {
+		a, b := r.Conflicts[i], r.Conflicts[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Reason < b.Reason
+	})
+
+	for name, zr := range result.ZoneResults {
+		zone := &ZoneReport{
+			Records:      zr.Records,
+			Changed:      zr.Changed,
+			Added:        zr.Added,
+			Removed:      zr.Removed,
+			RecordErrors: zr.RecordErrors,
+		}
+		for _, h := range zr.Hooks {
+			hr := &HookReport{
+				Command:         h.Command,
+				DurationSeconds: h.Duration.Seconds(),
+				Output:          h.Output,
+			}
+			if h.Err != nil {
+				hr.Error = h.Err.Error()
+			}
+			zone.Hooks = append(zone.Hooks, hr)
+		}
+		for _, n := range zr.Notifies {
+			nr := &NotifyReport{
+				Target:          n.Target,
+				DurationSeconds: n.Duration.Seconds(),
+				Rcode:           n.Rcode,
+			}
+			if n.Err != nil {
+				nr.Error = n.Err.Error()
+			}
+			zone.Notifies = append(zone.Notifies, nr)
+		}
+		if zr.Err != nil {
+			zone.Error = zr.Err.Error()
+		} else {
+			for _, n := range zr.Records {
+				zone.RecordsWritten += n
+			}
+			zone.RecordsWritten -= zr.RecordErrors
+		}
+		r.Zones[name] = zone
+	}
+
+	return r
+}
+
+// Write writes the report to w as indented JSON.
+func (r *Report) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,97 @@
+package netbox2dns
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	cfg := &Config{}
+	cfg.Netbox.Host = "netbox.example.com"
+
+	result := &SyncResult{
+		Start:     time.Unix(1700000000, 0),
+		Duration:  1500 * time.Millisecond,
+		Addresses: 4,
+		AddrStats: AddrStats{
+			Added:     2,
+			Skipped:   1,
+			Invalid:   []string{"bad name.example.com"},
+			Unmatched: []string{"c.example.org.", "1.2.0.192.in-addr.arpa."},
+		},
+		Conflicts: []Conflict{
+			{Name: "b.example.com.", Type: "PTR"},
+			{Name: "a.example.com.", Type: "CNAME", Reason: "static record"},
+			{Name: "b.example.com.", Type: "CNAME"},
+		},
+		ZoneResults: map[string]*ZoneResult{
+			"example.com":     {Records: map[string]int{"A": 1, "AAAA": 1}, Changed: true},
+			"example.net":     {Records: map[string]int{"A": 3}, Changed: true, RecordErrors: 1},
+			"10.in-addr.arpa": {Records: map[string]int{"PTR": 1}, Err: errors.New("permission denied")},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := NewReport(cfg, result, errors.New("permission denied")).Write(&buf)
+	if err != nil {
+		t.Fatalf("Write() returned an error: %v", err)
+	}
+
+	got := &Report{}
+	err = json.Unmarshal(buf.Bytes(), got)
+	if err != nil {
+		t.Fatalf("Report isn't valid JSON: %v\n%s", err, buf.String())
+	}
+
+	if got.Success {
+		t.Errorf("Success: got true, want false")
+	}
+	if got.NetboxHost != "netbox.example.com" {
+		t.Errorf("NetboxHost: got %q, want %q", got.NetboxHost, "netbox.example.com")
+	}
+	if got.DurationSeconds != 1.5 {
+		t.Errorf("DurationSeconds: got %v, want 1.5", got.DurationSeconds)
+	}
+	if len(got.UnmatchedNames) != 2 || got.UnmatchedNames[0] != "1.2.0.192.in-addr.arpa." {
+		t.Errorf("UnmatchedNames: got %v, want sorted list of 2 names", got.UnmatchedNames)
+	}
+	if len(got.InvalidNames) != 1 {
+		t.Errorf("InvalidNames: got %v, want 1 name", got.InvalidNames)
+	}
+	if len(got.Conflicts) != 3 || got.Conflicts[0].Name != "a.example.com." || got.Conflicts[1].Type != "CNAME" || got.Conflicts[2].Type != "PTR" {
+		t.Errorf("Conflicts: got %+v, want 3 conflicts sorted by name and type", got.Conflicts)
+	}
+
+	zone := got.Zones["example.com"]
+	if zone == nil || zone.RecordsWritten != 2 || !zone.Changed || zone.Error != "" {
+		t.Errorf("Zones[example.com]: got %+v, want 2 records, changed, no error", zone)
+	}
+	zone = got.Zones["example.net"]
+	if zone == nil || zone.RecordsWritten != 2 || zone.RecordErrors != 1 {
+		t.Errorf("Zones[example.net]: got %+v, want 2 records written and 1 record error", zone)
+	}
+	zone = got.Zones["10.in-addr.arpa"]
+	if zone == nil || zone.Error != "permission denied" || zone.RecordsWritten != 0 {
+		t.Errorf("Zones[10.in-addr.arpa]: got %+v, want error and no records written", zone)
+	}
+}
+
+func TestReportEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewReport(&Config{}, &SyncResult{}, nil).Write(&buf)
+	if err != nil {
+		t.Fatalf("Write() returned an error: %v", err)
+	}
+	got := map[string]any{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Report isn't valid JSON: %v\n%s", err, buf.String())
+	}
+	for _, key := range []string{"unmatched_names", "invalid_names", "conflicts"} {
+		if got[key] == nil {
+			t.Errorf("%s: got null, want []", key)
+		}
+	}
+}
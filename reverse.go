@@ -0,0 +1,189 @@
+package netbox2dns
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Naming conventions for RFC 2317 classless reverse zones, shown for
+// 192.0.2.64/27.
+const (
+	ClasslessSlash = "slash" // 64/27.2.0.192.in-addr.arpa
+	ClasslessDash  = "dash"  // 64-27.2.0.192.in-addr.arpa
+	ClasslessRange = "range" // 64-95.2.0.192.in-addr.arpa
+)
+
+// ClasslessZoneName returns the name of the RFC 2317 reverse zone for
+// prefix, which must be an IPv4 prefix longer than /24.
+func ClasslessZoneName(prefix netip.Prefix, style string) (string, error) {
+	if !prefix.Addr().Is4() || prefix.Bits() <= 24 {
+		return "", fmt.Errorf("Classless reverse zones need an IPv4 prefix longer than /24, not %s", prefix)
+	}
+	prefix = prefix.Masked()
+	b := prefix.Addr().As4()
+	first := int(b[3])
+	last := first + 1<<(32-prefix.Bits()) - 1
+
+	var label string
+	switch style {
+	case ClasslessSlash, "":
+		label = fmt.Sprintf("%d/%d", first, prefix.Bits())
+	case ClasslessDash:
+		label = fmt.Sprintf("%d-%d", first, prefix.Bits())
+	case ClasslessRange:
+		label = fmt.Sprintf("%d-%d", first, last)
+	default:
+		return "", fmt.Errorf("Unknown classless naming style %q", style)
+	}
+	return fmt.Sprintf("%s.%d.%d.%d.in-addr.arpa", label, b[2], b[1], b[0]), nil
+}
+
+// classlessCNAMEs returns the records that the parent zone needs to
+// delegate prefix to the classless zone named `child`: a CNAME for
+// every address in the prefix, and NS records for the child zone if
+// nameservers are given.
+func classlessCNAMEs(prefix netip.Prefix, child string, nameservers []string) []*Record {
+	var records []*Record
+	for _, ns := range nameservers {
+		records = append(records, &Record{
+			Name:    child + ".",
+			Type:    "NS",
+			Rrdatas: []string{absoluteName(ns, child)},
+		})
+	}
+	for addr := prefix.Masked().Addr(); prefix.Contains(addr); addr = addr.Next() {
+		records = append(records, &Record{
+			Name:    ReverseName(addr),
+			Type:    "CNAME",
+			Rrdatas: []string{fmt.Sprintf("%d.%s.", addr.As4()[3], child)},
+		})
+	}
+	return records
+}
+
+// ReverseZonePrefixes returns the prefixes of the reverse zones needed
+// to cover prefix.  Reverse zones are delegated on octet boundaries
+// for IPv4 and nibble boundaries for IPv6, so prefixes between
+// boundaries are split; 10.20.0.0/15 needs 20.10.in-addr.arpa and
+// 21.10.in-addr.arpa.  IPv4 prefixes longer than /24 aren't split;
+// they're RFC 2317 classless zones.
+func ReverseZonePrefixes(prefix netip.Prefix) []netip.Prefix {
+	prefix = prefix.Masked()
+	step := 4
+	if prefix.Addr().Is4() {
+		if prefix.Bits() > 24 {
+			return []netip.Prefix{prefix}
+		}
+		step = 8
+	}
+
+	bits := (prefix.Bits() + step - 1) / step * step
+	var prefixes []netip.Prefix
+	for i := 0; i < 1<<(bits-prefix.Bits()); i++ {
+		addr := addToPrefix(prefix.Addr(), i, bits)
+		prefixes = append(prefixes, netip.PrefixFrom(addr, bits))
+	}
+	return prefixes
+}
+
+// addToPrefix returns addr with n added to the bits just above a
+// prefix of length `bits`.
+func addToPrefix(addr netip.Addr, n, bits int) netip.Addr {
+	b := addr.AsSlice()
+	carry := n << ((8 - bits%8) % 8)
+	for i := (bits+7)/8 - 1; i >= 0 && carry > 0; i-- {
+		sum := int(b[i]) + carry
+		b[i] = byte(sum)
+		carry = sum >> 8
+	}
+	ret, _ := netip.AddrFromSlice(b)
+	return ret
+}
+
+// ReverseZoneName returns the name of the reverse zone for prefix,
+// which must be on an octet boundary for IPv4 or a nibble boundary
+// for IPv6.  IPv4 prefixes longer than /24 are named using
+// ClasslessZoneName with the given style.
+func ReverseZoneName(prefix netip.Prefix, style string) (string, error) {
+	prefix = prefix.Masked()
+	if prefix.Addr().Is4() {
+		if prefix.Bits() > 24 {
+			return ClasslessZoneName(prefix, style)
+		}
+		if prefix.Bits()%8 != 0 {
+			return "", fmt.Errorf("%s isn't on an octet boundary", prefix)
+		}
+		name := ReverseName(prefix.Addr())
+		labels := strings.Split(name, ".")
+		return strings.Join(labels[4-prefix.Bits()/8:len(labels)-1], "."), nil
+	}
+
+	if prefix.Bits()%4 != 0 {
+		return "", fmt.Errorf("%s isn't on a nibble boundary", prefix)
+	}
+	name := ReverseName(prefix.Addr())
+	labels := strings.Split(name, ".")
+	return strings.Join(labels[32-prefix.Bits()/4:len(labels)-1], "."), nil
+}
+
+// ReverseZonePrefix returns the prefix covered by the reverse zone
+// `name`, like 10.0.0.0/8 for `10.in-addr.arpa`.  It returns false if
+// name isn't a reverse zone.
+func ReverseZonePrefix(name string) (netip.Prefix, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	if rest, ok := strings.CutSuffix(name, "in-addr.arpa"); ok {
+		labels := splitReverseLabels(rest)
+		if labels == nil || len(labels) > 4 {
+			return netip.Prefix{}, false
+		}
+		var b [4]byte
+		for i, l := range labels {
+			n, err := strconv.Atoi(l)
+			if err != nil || n < 0 || n > 255 || strconv.Itoa(n) != l {
+				return netip.Prefix{}, false
+			}
+			b[len(labels)-1-i] = byte(n)
+		}
+		return netip.PrefixFrom(netip.AddrFrom4(b), len(labels)*8), true
+	}
+
+	if rest, ok := strings.CutSuffix(name, "ip6.arpa"); ok {
+		labels := splitReverseLabels(rest)
+		if labels == nil || len(labels) > 32 {
+			return netip.Prefix{}, false
+		}
+		var b [16]byte
+		for i, l := range labels {
+			n, err := strconv.ParseUint(l, 16, 8)
+			if err != nil || len(l) != 1 {
+				return netip.Prefix{}, false
+			}
+			nibble := len(labels) - 1 - i
+			if nibble%2 == 0 {
+				b[nibble/2] |= byte(n) << 4
+			} else {
+				b[nibble/2] |= byte(n)
+			}
+		}
+		return netip.PrefixFrom(netip.AddrFrom16(b), len(labels)*4), true
+	}
+
+	return netip.Prefix{}, false
+}
+
+// splitReverseLabels splits the part of a reverse zone name before
+// `in-addr.arpa` or `ip6.arpa` into labels.  It returns nil if the
+// name is malformed.
+func splitReverseLabels(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	s, ok := strings.CutSuffix(s, ".")
+	if !ok {
+		return nil
+	}
+	return strings.Split(s, ".")
+}
@@ -0,0 +1,189 @@
+package netbox2dns
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClasslessZoneName(t *testing.T) {
+	tests := []struct {
+		prefix, style, want string
+	}{
+		{"192.0.2.64/27", "", "64/27.2.0.192.in-addr.arpa"},
+		{"192.0.2.64/27", ClasslessSlash, "64/27.2.0.192.in-addr.arpa"},
+		{"192.0.2.64/27", ClasslessDash, "64-27.2.0.192.in-addr.arpa"},
+		{"192.0.2.64/27", ClasslessRange, "64-95.2.0.192.in-addr.arpa"},
+		{"192.0.2.70/27", ClasslessSlash, "64/27.2.0.192.in-addr.arpa"},
+		{"192.0.2.128/25", ClasslessRange, "128-255.2.0.192.in-addr.arpa"},
+	}
+	for _, test := range tests {
+		got, err := ClasslessZoneName(netip.MustParsePrefix(test.prefix), test.style)
+		if err != nil {
+			t.Errorf("ClasslessZoneName(%s, %q) returned an error: %v", test.prefix, test.style, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ClasslessZoneName(%s, %q): got %q, want %q", test.prefix, test.style, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{"192.0.2.0/24", "10.0.0.0/8", "2001:db8::/64"} {
+		if _, err := ClasslessZoneName(netip.MustParsePrefix(bad), ""); err == nil {
+			t.Errorf("ClasslessZoneName(%s) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestParseClassless(t *testing.T) {
+	cfg, err := ParseConfig("testdata/config9/conf.yaml")
+	if err != nil {
+		t.Fatalf("Unable to parse config: %v", err)
+	}
+
+	for _, name := range []string{"64/27.2.0.192.in-addr.arpa", "128-191.100.51.198.in-addr.arpa", "100.51.198.in-addr.arpa", "20.10.in-addr.arpa"} {
+		if cfg.ZoneMap[name] == nil {
+			t.Errorf("cfg.ZoneMap[%q] is missing", name)
+		}
+	}
+	if len(cfg.Zones) != 9 || len(cfg.ZoneMap) != 9 {
+		t.Errorf("got %d zones and %d in ZoneMap, want 9", len(cfg.Zones), len(cfg.ZoneMap))
+	}
+	z := cfg.ZoneMap["3.0.1.0.8.b.d.0.1.0.0.2.ip6.arpa"]
+	if z == nil {
+		t.Fatalf("cfg.ZoneMap is missing the last zone for 2001:db8:100::/46")
+	}
+	if z.Filename != "reverse-3.0.1.0.8.b.d.0.1.0.0.2.ip6.arpa.zone" || z.Prefix != "2001:db8:103::/48" {
+		t.Errorf("zone for 2001:db8:103::/48: got filename %q and prefix %q", z.Filename, z.Prefix)
+	}
+
+	problems, _ := CheckConfig("testdata/config9/conf.yaml")
+	if len(problems) != 0 {
+		t.Errorf("CheckConfig(config9) returned %d problems, want 0: %v", len(problems), problems)
+	}
+
+	for _, bad := range []*ConfigZone{
+		{Name: "64/27.2.0.193.in-addr.arpa", Prefix: "192.0.2.64/27"},
+		{Name: "10.in-addr.arpa", Prefix: "10.0.0.0/16"},
+		{Name: "10.in-addr.arpa", Prefix: "10.0.0.0/7"},
+		{Prefix: "10.0.0.0/7", Filename: "same.zone"},
+		{Prefix: "10.0.0.0/8", Filename: "{{.Nope}}.zone"},
+	} {
+		if _, err := bad.expand(""); err == nil {
+			t.Errorf("expand(%+v) succeeded, want error", bad)
+		}
+	}
+	bad := &ConfigZone{Name: "1.198.in-addr.arpa", ClasslessDelegations: []*ConfigDelegation{{Prefix: "198.51.100.0/28"}}}
+	if _, err := bad.expand(""); err == nil {
+		t.Errorf("expand() with a delegation outside the zone succeeded, want error")
+	}
+}
+
+func TestClasslessRouting(t *testing.T) {
+	z := NewZones()
+	z.NewZone(&ConfigZone{Name: "2.0.192.in-addr.arpa", TTL: 300})
+	z.NewZone(&ConfigZone{Name: "10.in-addr.arpa", TTL: 300})
+	z.NewZone(&ConfigZone{Name: "20.10.in-addr.arpa", Prefix: "10.20.0.0/16", TTL: 300})
+	z.NewZone(&ConfigZone{Name: "0.0.1.0.8.b.d.0.1.0.0.2.ip6.arpa", TTL: 300})
+	z.NewZone(&ConfigZone{Name: "64/27.2.0.192.in-addr.arpa", Prefix: "192.0.2.64/27", TTL: 300})
+	z.NewZone(&ConfigZone{Name: "100.51.198.in-addr.arpa", TTL: 300, ClasslessDelegations: []*ConfigDelegation{
+		{Prefix: "198.51.100.0/30", Nameservers: []string{"ns1.customer.example."}},
+	}})
+
+	tests := []struct {
+		addr, zone, name string
+	}{
+		{"192.0.2.1", "2.0.192.in-addr.arpa", "1.2.0.192.in-addr.arpa."},
+		{"10.1.2.3", "10.in-addr.arpa", "3.2.1.10.in-addr.arpa."},
+		{"10.20.2.3", "20.10.in-addr.arpa", "3.2.20.10.in-addr.arpa."},
+		{"2001:db8:100::1", "0.0.1.0.8.b.d.0.1.0.0.2.ip6.arpa", "1." + strings.Repeat("0.", 19) + "0.0.1.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+		{"2001:db8:200::1", "", ""},
+		{"192.0.2.65", "64/27.2.0.192.in-addr.arpa", "65.64/27.2.0.192.in-addr.arpa."},
+		{"192.0.2.95", "64/27.2.0.192.in-addr.arpa", "95.64/27.2.0.192.in-addr.arpa."},
+		{"192.0.2.96", "2.0.192.in-addr.arpa", "96.2.0.192.in-addr.arpa."},
+		{"198.51.100.2", "", "2.100.51.198.in-addr.arpa."},
+		{"198.51.100.4", "100.51.198.in-addr.arpa", "4.100.51.198.in-addr.arpa."},
+	}
+	for _, test := range tests {
+		addr := netip.MustParseAddr(test.addr)
+		zone, name := z.ZoneForRecord(&Record{Name: ReverseName(addr), Type: "PTR", Addr: addr})
+		zoneName := ""
+		if zone != nil {
+			zoneName = zone.Name
+		}
+		if zoneName != test.zone || (zone != nil && name != test.name) {
+			t.Errorf("ZoneForRecord(PTR for %s): got %q in %q, want %q in %q", test.addr, name, zoneName, test.name, test.zone)
+		}
+	}
+
+	records := z.Zones["100.51.198.in-addr.arpa"].Records
+	if len(records) != 5 {
+		t.Fatalf("parent zone has %d records, want 1 NS and 4 CNAMEs: %v", len(records), records)
+	}
+	if r := records[0]; r.Type != "NS" || r.Name != "0/30.100.51.198.in-addr.arpa." || r.Rrdatas[0] != "ns1.customer.example." {
+		t.Errorf("parent zone NS record: got %+v", r)
+	}
+	if r := records[3]; r.Type != "CNAME" || r.Name != "2.100.51.198.in-addr.arpa." || r.Rrdatas[0] != "2.0/30.100.51.198.in-addr.arpa." {
+		t.Errorf("parent zone CNAME record: got %+v", r)
+	}
+}
+
+func TestReverseZonePrefixes(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"10.0.0.0/8", []string{"10.0.0.0/8"}},
+		{"10.20.0.0/15", []string{"10.20.0.0/16", "10.21.0.0/16"}},
+		{"10.20.4.0/22", []string{"10.20.4.0/24", "10.20.5.0/24", "10.20.6.0/24", "10.20.7.0/24"}},
+		{"192.0.2.64/27", []string{"192.0.2.64/27"}},
+		{"2001:db8:100::/48", []string{"2001:db8:100::/48"}},
+		{"2001:db8:100::/47", []string{"2001:db8:100::/48", "2001:db8:101::/48"}},
+		{"2001:db8:ff0::/42", []string{"2001:db8:fc0::/44", "2001:db8:fd0::/44", "2001:db8:fe0::/44", "2001:db8:ff0::/44"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, p := range ReverseZonePrefixes(netip.MustParsePrefix(test.prefix)) {
+			got = append(got, p.String())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ReverseZonePrefixes(%s): got %v, want %v", test.prefix, got, test.want)
+		}
+	}
+}
+
+func TestReverseZoneName(t *testing.T) {
+	tests := []struct {
+		prefix, want string
+	}{
+		{"10.0.0.0/8", "10.in-addr.arpa"},
+		{"10.20.0.0/16", "20.10.in-addr.arpa"},
+		{"192.0.2.0/24", "2.0.192.in-addr.arpa"},
+		{"192.0.2.64/27", "64/27.2.0.192.in-addr.arpa"},
+		{"2001:db8::/32", "8.b.d.0.1.0.0.2.ip6.arpa"},
+		{"2001:db8:100::/44", "0.1.0.8.b.d.0.1.0.0.2.ip6.arpa"},
+	}
+	for _, test := range tests {
+		got, err := ReverseZoneName(netip.MustParsePrefix(test.prefix), "")
+		if err != nil || got != test.want {
+			t.Errorf("ReverseZoneName(%s): got %q, %v; want %q", test.prefix, got, err, test.want)
+		}
+
+		prefix, ok := ReverseZonePrefix(got)
+		if !strings.Contains(got, "/") && (!ok || prefix != netip.MustParsePrefix(test.prefix)) {
+			t.Errorf("ReverseZonePrefix(%q): got %s, %v; want %s", got, prefix, ok, test.prefix)
+		}
+	}
+
+	for _, bad := range []string{"10.0.0.0/12", "2001:db8::/30"} {
+		if _, err := ReverseZoneName(netip.MustParsePrefix(bad), ""); err == nil {
+			t.Errorf("ReverseZoneName(%s) succeeded, want error", bad)
+		}
+	}
+	for _, bad := range []string{"example.com", "300.in-addr.arpa", "1.2.3.4.5.in-addr.arpa", "10.ip6.arpa", "64/27.2.0.192.in-addr.arpa"} {
+		if _, ok := ReverseZonePrefix(bad); ok {
+			t.Errorf("ReverseZonePrefix(%q) succeeded, want false", bad)
+		}
+	}
+}
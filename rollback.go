@@ -0,0 +1,101 @@
+package netbox2dns
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/scottlaird/netbox2dns/zonefile"
+)
+
+// zoneBackup returns where the previous versions of cz's zone file
+// are kept, or nil if backups aren't enabled.
+func zoneBackup(cfg *Config, cz *ConfigZone) *zonefile.Backup {
+	if cfg.Backups.Directory == "" {
+		return nil
+	}
+	return &zonefile.Backup{
+		Dir:  filepath.Join(cfg.Backups.Directory, strings.ReplaceAll(cz.Name, "/", "-")),
+		Keep: cfg.Backups.Keep,
+		Gzip: cfg.Backups.Gzip,
+	}
+}
+
+// backupZone returns the configured zone named `name`, along with
+// where its backups are kept.
+func backupZone(cfg *Config, name string) (*ConfigZone, *zonefile.Backup, error) {
+	if cfg.Backups.Directory == "" {
+		return nil, nil, fmt.Errorf("Backups aren't enabled; set backups.directory")
+	}
+	name = strings.TrimSuffix(name, ".")
+	cz, ok := cfg.ZoneMap[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("Zone %q isn't configured", name)
+	}
+	if cz.ZoneType != "zonefile" {
+		return nil, nil, fmt.Errorf("Zone %q isn't written to a zone file", name)
+	}
+	return cz, zoneBackup(cfg, cz), nil
+}
+
+// ListBackups returns the backups of the named zone, oldest first.
+func ListBackups(cfg *Config, name string) ([]zonefile.BackupFile, error) {
+	_, backup, err := backupZone(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+	return backup.List()
+}
+
+// RollbackResult describes a zone restored by Rollback.
+type RollbackResult struct {
+	Backup   zonefile.BackupFile // The backup that was restored
+	Changes  Changes
+	Hooks    []HookResult
+	Notifies []NotifyResult
+
+	// GitCommit is the hash of the commit of the restored file, if
+	// git.repository is set.
+	GitCommit string
+}
+
+// Rollback restores the named zone's file from the backup with the
+// given timestamp, or from the newest backup if timestamp is "", and
+// then runs the zone's on_change hooks.  The current file is backed
+// up first.  Discovered zones can't be rolled back, since finding them
+// needs NetBox.
+//
+// If committing the restored file to git fails, the zone has still
+// been restored, so both the result and the error are returned.
+func Rollback(ctx context.Context, cfg *Config, name, timestamp string) (*RollbackResult, error) {
+	cz, _, err := backupZone(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+	zfd, err := NewZoneFileDNS(ctx, cfg, cz)
+	if err != nil {
+		return nil, err
+	}
+
+	file, c, err := zfd.zone.Restore(timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to restore %q: %w", cz.Name, err)
+	}
+	result := &RollbackResult{
+		Backup:  file,
+		Changes: Changes{Changed: c.Changed, Added: c.Added, Removed: c.Removed, Serial: c.Serial},
+	}
+	result.Hooks = RunHooks(ctx, cfg, cz, result.Changes)
+	result.Notifies = notifyZone(ctx, cz, result.Changes, result.Hooks)
+
+	if cfg.Git.Repository != "" {
+		message := fmt.Sprintf("Roll back %s to the version from %s\n\n%s: %d added, %d removed\n",
+			cz.Name, file.Timestamp, cz.Name, c.Added, c.Removed)
+		result.GitCommit, err = commitFiles(ctx, cfg, []string{cz.Filename}, message)
+		if err != nil {
+			return result, fmt.Errorf("Unable to commit zone file: %w", err)
+		}
+	}
+	return result, nil
+}
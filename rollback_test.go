@@ -0,0 +1,77 @@
+package netbox2dns
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRollback(t *testing.T) {
+	dir := t.TempDir()
+	cz := &ConfigZone{
+		ZoneType: "zonefile",
+		Name:     "example.com",
+		Filename: filepath.Join(dir, "example.com.zone"),
+		TTL:      300,
+		OnChange: []*ConfigHook{
+			{Command: []string{"sh", "-c", `echo "$NETBOX2DNS_ZONE $NETBOX2DNS_ADDED $NETBOX2DNS_REMOVED" > ` + filepath.Join(dir, "hook")}},
+		},
+	}
+	cfg := &Config{ZoneMap: map[string]*ConfigZone{"example.com": cz}}
+
+	if _, err := Rollback(context.Background(), cfg, "example.com", ""); err == nil {
+		t.Errorf("Rollback() without backups enabled didn't return an error")
+	}
+	cfg.Backups.Directory = filepath.Join(dir, "backups")
+	cfg.Backups.Keep = 10
+
+	write := func(addr string) {
+		zfd, err := NewZoneFileDNS(context.Background(), cfg, cz)
+		if err != nil {
+			t.Fatalf("NewZoneFileDNS() returned an error: %v", err)
+		}
+		zfd.WriteRecord(cz, &Record{Name: "a.example.com.", Type: "A", TTL: 300, Rrdatas: []string{addr}})
+		if _, err := zfd.Save(cz); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+		old := time.Now().Add(-time.Hour)
+		os.Chtimes(cz.Filename, old, old)
+	}
+	write("10.0.0.1")
+	write("10.0.0.2")
+
+	backups, err := ListBackups(cfg, "example.com.")
+	if err != nil {
+		t.Fatalf("ListBackups() returned an error: %v", err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("ListBackups() returned %d backups, want 1", len(backups))
+	}
+	if _, err := Rollback(context.Background(), cfg, "example.net", ""); err == nil {
+		t.Errorf("Rollback() of an unknown zone didn't return an error")
+	}
+
+	result, err := Rollback(context.Background(), cfg, "example.com", backups[0].Timestamp)
+	if err != nil {
+		t.Fatalf("Rollback() returned an error: %v", err)
+	}
+	if len(result.Hooks) != 1 || result.Hooks[0].Err != nil {
+		t.Errorf("Rollback() hooks: got %+v, want one successful hook", result.Hooks)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "hook"))
+	if err != nil {
+		t.Fatalf("Unable to read hook output: %v", err)
+	}
+	if want := "example.com 1 1\n"; string(b) != want {
+		t.Errorf("hook output: got %q, want %q", string(b), want)
+	}
+	b, err = os.ReadFile(cz.Filename)
+	if err != nil {
+		t.Fatalf("Unable to read zone file: %v", err)
+	}
+	if want := "a.example.com. 300 IN A 10.0.0.1\n"; string(b) != want {
+		t.Errorf("zone file after Rollback(): got %q, want %q", string(b), want)
+	}
+}
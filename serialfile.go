@@ -0,0 +1,78 @@
+package netbox2dns
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/scottlaird/netbox2dns/zonefile"
+)
+
+// serialFile keeps the last serial of each zone served by a
+// DNSServer, in `dns_server.serial_file`.  Zone files keep their own
+// serials, but served zones only exist in memory, so without it every
+// zone would start over with a low serial after a restart, and
+// secondaries holding a higher serial would stop picking up changes.
+type serialFile struct {
+	filename string
+	serials  map[string]uint32 // By lower-case, fully-qualified zone name
+}
+
+// loadSerialFile reads the serials saved in filename.  A missing file
+// has no serials.
+func loadSerialFile(filename string) (*serialFile, error) {
+	sf := &serialFile{filename: filename, serials: map[string]uint32{}}
+	b, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return sf, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read serial file: %w", err)
+	}
+	if err := json.Unmarshal(b, &sf.serials); err != nil {
+		return nil, fmt.Errorf("Unable to parse serial file %q: %w", filename, err)
+	}
+	return sf, nil
+}
+
+// last returns the last serial saved for the named zone.  It's safe
+// to call on a nil *serialFile, which has no serials.
+func (sf *serialFile) last(name string) (uint32, bool) {
+	if sf == nil {
+		return 0, false
+	}
+	serial, ok := sf.serials[name]
+	return serial, ok
+}
+
+// update saves the serial of every zone in gen.  Zones that aren't in
+// gen keep their saved serial, in case they come back later.  The file
+// is only rewritten if a serial changed.
+func (sf *serialFile) update(gen *memZones) error {
+	serials := make(map[string]uint32, len(sf.serials))
+	changed := false
+	for name, serial := range sf.serials {
+		serials[name] = serial
+	}
+	for name, z := range gen.zones {
+		if old, ok := serials[name]; !ok || old != z.soa.Serial {
+			serials[name] = z.soa.Serial
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	err := zonefile.WriteFileAtomic(sf.filename, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(serials)
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to write serial file: %w", err)
+	}
+	sf.serials = serials
+	return nil
+}
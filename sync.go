@@ -0,0 +1,266 @@
+package netbox2dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/scottlaird/netbox2dns/netboxlib"
+)
+
+// SyncOptions controls which parts of the config Sync writes.
+type SyncOptions struct {
+	// Zones lists the names of the zones to write.  If it's
+	// empty, then every zone is written.  Records are still
+	// generated for every zone, so that each record lands in the
+	// same zone that it would in a full sync.  Records that don't
+	// match any zone are still counted in the result, but aren't
+	// logged.
+	Zones []string
+}
+
+// SelectZones returns the names of all zones in cfg that match any of
+// patterns, sorted by name.  Patterns use path.Match syntax, so
+// `*.example.com` matches `internal.example.com`.  Unlike in paths,
+// `*` also matches `/`, so `*.in-addr.arpa` matches RFC 2317 classless
+// zones like `0/26.2.0.192.in-addr.arpa`.  It's an error for a pattern
+// to match no zones, since that's usually a typo.
+func SelectZones(cfg *Config, patterns []string) ([]string, error) {
+	found := map[string]bool{}
+	for _, p := range patterns {
+		p = strings.TrimSuffix(p, ".")
+		matched := false
+		for name := range cfg.ZoneMap {
+			ok, err := matchZone(p, name)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid zone pattern %q: %w", p, err)
+			}
+			if ok {
+				found[name] = true
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("Zone pattern %q doesn't match any configured zone", p)
+		}
+	}
+
+	zones := make([]string, 0, len(found))
+	for name := range found {
+		zones = append(zones, name)
+	}
+	sort.Strings(zones)
+	return zones, nil
+}
+
+// matchZone reports whether the zone named name matches pattern, as
+// path.Match does, but with `/` treated as an ordinary character.
+func matchZone(pattern, name string) (bool, error) {
+	return path.Match(strings.ReplaceAll(pattern, "/", "\x00"), strings.ReplaceAll(name, "/", "\x00"))
+}
+
+// selected returns true if the zone named `name` should be written.
+func (o SyncOptions) selected(name string) bool {
+	if len(o.Zones) == 0 {
+		return true
+	}
+	for _, z := range o.Zones {
+		if z == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SyncResult summarizes a single run of Sync.
+type SyncResult struct {
+	Start         time.Time
+	Duration      time.Duration
+	Addresses     int           // Number of IP addresses fetched from NetBox
+	FetchDuration time.Duration // Time spent fetching from NetBox
+	FetchPages    int           // Number of API requests made to NetBox
+	Zones         int           // Number of zones written
+	AddrStats     AddrStats
+	Conflicts     []Conflict    // Conflicting records in the written zones
+	Discovered    []*ConfigZone // Reverse zones discovered from NetBox prefixes
+	ZoneResults   map[string]*ZoneResult
+	GitCommit     string // Hash of the commit of changed zone files, if any
+}
+
+// ZoneResult describes what happened to a single zone during Sync.
+type ZoneResult struct {
+	Records       map[string]int // Number of records of each type
+	Changed       bool           // True if the zone's contents changed
+	Added         int            // Number of records added, if Changed
+	Removed       int            // Number of records removed, if Changed
+	RecordErrors  int            // Number of records the provider couldn't write
+	ApplyDuration time.Duration  // Time spent writing the zone
+	Hooks         []HookResult   // on_change hooks run for the zone
+	Notifies      []NotifyResult // NOTIFY messages sent for the zone
+	Err           error
+}
+
+// Sync fetches all IP addresses from NetBox, generates forward and
+// reverse records for them, and writes the zones selected by opts.
+// A failure in one zone doesn't stop the remaining zones from being
+// written; all errors are returned together.
+func Sync(ctx context.Context, cfg *Config, opts SyncOptions) (*SyncResult, error) {
+	result := &SyncResult{
+		Start:       time.Now(),
+		ZoneResults: make(map[string]*ZoneResult),
+	}
+	defer func() {
+		result.Duration = time.Since(result.Start)
+	}()
+
+	newZones, zoneMap, err := fetchZones(cfg, opts, result)
+	if err != nil {
+		return result, err
+	}
+
+	var errs []error
+	changed := map[string]*ConfigZone{}
+	for _, zone := range newZones.Zones {
+		if !opts.selected(zone.Name) {
+			continue
+		}
+
+		zr := &ZoneResult{Records: make(map[string]int)}
+		result.ZoneResults[zone.Name] = zr
+
+		if err := prepareZone(zone, zr, result); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		start := time.Now()
+		changes, err := writeZone(ctx, cfg, zoneMap[zone.Name], zone, zr)
+		zr.ApplyDuration = time.Since(start)
+		if err != nil {
+			zr.Err = err
+			errs = append(errs, zr.Err)
+			continue
+		}
+		if zr.RecordErrors > 0 {
+			errs = append(errs, fmt.Errorf("Failed to write %d records in %q", zr.RecordErrors, zone.Name))
+		}
+		zr.Changed, zr.Added, zr.Removed = changes.Changed, changes.Added, changes.Removed
+		result.Zones++
+
+		if changes.Changed {
+			changed[zone.Name] = zoneMap[zone.Name]
+			zr.Hooks = RunHooks(ctx, cfg, zoneMap[zone.Name], changes)
+			for _, h := range zr.Hooks {
+				if h.Err != nil {
+					errs = append(errs, fmt.Errorf("on_change hook %q for %q failed: %w", h.Command, zone.Name, h.Err))
+				}
+			}
+			zr.Notifies = notifyZone(ctx, zoneMap[zone.Name], changes, zr.Hooks)
+		}
+	}
+
+	if cfg.Git.Repository != "" {
+		result.GitCommit, err = commitZones(ctx, cfg, changed, result.ZoneResults)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return result, errors.Join(errs...)
+}
+
+// fetchZones fetches all IP addresses from NetBox and adds records
+// for them to a new Zones, with a Zone for every configured and
+// discovered zone.  It returns the zones along with the config for
+// each of them, and records what it fetched in result.
+func fetchZones(cfg *Config, opts SyncOptions, result *SyncResult) (*Zones, map[string]*ConfigZone, error) {
+	netboxClient := netboxlib.NewClient(cfg.Netbox.Host, cfg.Netbox.Token)
+	zoneMap, discovered, err := DiscoverZones(cfg, netboxClient)
+	if err != nil {
+		result.FetchDuration = time.Since(result.Start)
+		result.FetchPages = netboxClient.Requests()
+		return nil, nil, err
+	}
+	result.Discovered = discovered
+
+	addrs, err := netboxClient.GetNetboxIPAddresses(nil)
+	result.FetchDuration = time.Since(result.Start)
+	result.FetchPages = netboxClient.Requests()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to fetch IP Addresses from Netbox: %w", err)
+	}
+
+	// Create new zones using data from Netbox
+	newZones := NewZones()
+	for _, cz := range zoneMap {
+		newZones.NewZone(cz)
+	}
+	result.Addresses = len(addrs)
+	log.Infof("Found %d IP Addresses in %d zones", len(addrs), len(newZones.Zones))
+
+	// Add Netbox IPs to our new zones
+	stats, err := newZones.AddAddrs(addrs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to add IP addresses: %w", err)
+	}
+	result.AddrStats = *stats
+	if len(opts.Zones) == 0 && len(stats.Unmatched) > 0 {
+		log.Warningf("%d records don't match any zone: %v", len(stats.Unmatched), stats.Unmatched)
+	}
+	return newZones, zoneMap, nil
+}
+
+// prepareZone adds a zone's static records, counts its records in zr,
+// and adds any conflicting records to result.  Errors are also
+// recorded in zr.
+func prepareZone(zone *Zone, zr *ZoneResult, result *SyncResult) error {
+	static, err := zone.AddStaticRecords()
+	if err != nil {
+		zr.Err = err
+		return err
+	}
+	for _, c := range static {
+		log.Warningf("Dropping NetBox records for %q: %s: %v", c.Name, c.Reason, c.Values)
+		result.Conflicts = append(result.Conflicts, c)
+	}
+
+	for _, rec := range zone.Records {
+		zr.Records[rec.Type]++
+	}
+
+	for _, c := range zone.Conflicts() {
+		log.Warningf("Conflicting %s records for %q: %v", c.Type, c.Name, c.Values)
+		result.Conflicts = append(result.Conflicts, c)
+	}
+	return nil
+}
+
+// writeZone writes all of the records in zone using the provider
+// described by cz.  It returns how the zone changed.  Records that the
+// provider can't write are logged and counted in zr, and the rest of
+// the zone is still saved.
+func writeZone(ctx context.Context, cfg *Config, cz *ConfigZone, zone *Zone, zr *ZoneResult) (Changes, error) {
+	provider, err := NewDNSProvider(ctx, cfg, cz)
+	if err != nil {
+		return Changes{}, fmt.Errorf("Failed to create DNS provider for %q: %w", zone.Name, err)
+	}
+
+	for _, rec := range zone.Records {
+		err = provider.WriteRecord(cz, rec)
+		if err != nil {
+			log.Errorf("Failed to update record: %v", err)
+			zr.RecordErrors++
+		}
+	}
+
+	changes, err := provider.Save(cz)
+	if err != nil {
+		return Changes{}, fmt.Errorf("Failed to save %q: %w", zone.Name, err)
+	}
+	return changes, nil
+}
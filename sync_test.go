@@ -0,0 +1,57 @@
+package netbox2dns
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectZones(t *testing.T) {
+	cfg, err := ParseConfig("testdata/config4/conf.yaml")
+	if err != nil {
+		t.Fatalf("Unable to parse config: %v", err)
+	}
+	cfg.ZoneMap["0/26.2.0.192.in-addr.arpa"] = &ConfigZone{Name: "0/26.2.0.192.in-addr.arpa"}
+
+	tests := []struct {
+		patterns []string
+		want     []string
+	}{
+		{[]string{"example.com"}, []string{"example.com"}},
+		{[]string{"internal.example.com.", "10.in-addr.arpa"}, []string{"10.in-addr.arpa", "internal.example.com"}},
+		{[]string{"*.arpa"}, []string{"0.0.0.0.ip6.arpa", "0/26.2.0.192.in-addr.arpa", "10.in-addr.arpa"}},
+		{[]string{"*.2.0.192.in-addr.arpa"}, []string{"0/26.2.0.192.in-addr.arpa"}},
+		{[]string{"0/26.2.0.192.in-addr.arpa."}, []string{"0/26.2.0.192.in-addr.arpa"}},
+		{[]string{"*example.com", "example.com"}, []string{"example.com", "internal.example.com"}},
+	}
+	for _, test := range tests {
+		got, err := SelectZones(cfg, test.patterns)
+		if err != nil {
+			t.Errorf("SelectZones(%v) returned an error: %v", test.patterns, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SelectZones(%v): got %v, want %v", test.patterns, got, test.want)
+		}
+	}
+
+	for _, bad := range [][]string{{"example.org"}, {"example.com", "nope.*"}, {"[.arpa"}} {
+		if _, err := SelectZones(cfg, bad); err == nil {
+			t.Errorf("SelectZones(%v) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestSyncOptionsSelected(t *testing.T) {
+	all := SyncOptions{}
+	if !all.selected("example.com") {
+		t.Errorf("empty SyncOptions didn't select example.com")
+	}
+
+	some := SyncOptions{Zones: []string{"10.in-addr.arpa"}}
+	if some.selected("example.com") {
+		t.Errorf("SyncOptions{10.in-addr.arpa} selected example.com")
+	}
+	if !some.selected("10.in-addr.arpa") {
+		t.Errorf("SyncOptions{10.in-addr.arpa} didn't select 10.in-addr.arpa")
+	}
+}
@@ -0,0 +1,266 @@
+package netbox2dns
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/miekg/dns"
+	"github.com/scottlaird/netbox2dns/zonefile"
+)
+
+// transferBatch is the most records sent in each message of a zone
+// transfer.
+const transferBatch = 200
+
+// tsigFudge is the allowed clock skew for TSIG-signed responses.
+const tsigFudge = 300
+
+// tsigAlgorithms maps the TSIG algorithms allowed in `tsig_keys` to
+// their hash functions.
+var tsigAlgorithms = map[string]func() hash.Hash{
+	dns.HmacSHA1:   sha1.New,
+	dns.HmacSHA224: sha256.New224,
+	dns.HmacSHA256: sha256.New,
+	dns.HmacSHA384: sha512.New384,
+	dns.HmacSHA512: sha512.New,
+}
+
+// transferConfig holds the zone transfer settings from
+// `dns_server`, parsed for use by a DNSServer.
+type transferConfig struct {
+	acl  []netip.Prefix      // Addresses allowed to transfer zones
+	keys map[string]*tsigKey // By lower-case, fully-qualified name
+}
+
+// tsigKey is a single TSIG key.
+type tsigKey struct {
+	algorithm string // Fully-qualified, like "hmac-sha256."
+	secret    []byte
+}
+
+// newTransferConfig parses the zone transfer settings in
+// cfg.DNSServer.  Invalid ACL entries and keys are left out, and
+// returned together as an error.
+func newTransferConfig(cfg *Config) (*transferConfig, error) {
+	tc := &transferConfig{keys: map[string]*tsigKey{}}
+	var errs []error
+
+	for _, a := range cfg.DNSServer.AllowTransfer {
+		prefix, err := netip.ParsePrefix(a)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(a)
+			if addrErr != nil {
+				errs = append(errs, fmt.Errorf("Invalid allow_transfer address %q: %w", a, err))
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		tc.acl = append(tc.acl, prefix.Masked())
+	}
+
+	for _, k := range cfg.DNSServer.TSIGKeys {
+		name := strings.ToLower(dns.Fqdn(k.Name))
+		algorithm := dns.Fqdn(k.Algorithm)
+		secret, err := base64.StdEncoding.DecodeString(k.Secret)
+		switch {
+		case tsigAlgorithms[algorithm] == nil:
+			errs = append(errs, fmt.Errorf("Unsupported algorithm %q for TSIG key %q", k.Algorithm, k.Name))
+		case err != nil || len(secret) == 0:
+			errs = append(errs, fmt.Errorf("Invalid secret for TSIG key %q: it must be base64-encoded", k.Name))
+		case tc.keys[name] != nil:
+			errs = append(errs, fmt.Errorf("TSIG key %q is defined more than once", k.Name))
+		default:
+			tc.keys[name] = &tsigKey{algorithm: algorithm, secret: secret}
+		}
+	}
+	return tc, errors.Join(errs...)
+}
+
+// allowed returns true if addr may transfer zones.
+func (tc *transferConfig) allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range tc.acl {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ixfrDelta is the difference between two successive versions of a
+// zone, in the form that IXFR sends it.
+type ixfrDelta struct {
+	from, to *dns.SOA
+	removed  []dns.RR
+	added    []dns.RR
+}
+
+// axfr returns the records for a full transfer of the zone: its SOA,
+// every other record, and the SOA again.
+func (z *memZone) axfr() []dns.RR {
+	rrs := make([]dns.RR, 0, len(z.records)+2)
+	rrs = append(rrs, z.soa)
+	rrs = append(rrs, z.records...)
+	return append(rrs, z.soa)
+}
+
+// ixfr returns the records for an incremental transfer to a secondary
+// that has the given serial, as RFC 1995 describes.  Secondaries that
+// are up to date just get the current SOA.  If the zone's history
+// doesn't go back as far as serial, a full transfer is returned
+// instead, which RFC 1995 allows.
+func (z *memZone) ixfr(serial uint32) []dns.RR {
+	if !zonefile.SerialGreater(z.soa.Serial, serial) {
+		return []dns.RR{z.soa}
+	}
+	for i, d := range z.history {
+		if d.from.Serial != serial {
+			continue
+		}
+		rrs := []dns.RR{z.soa}
+		for _, d := range z.history[i:] {
+			rrs = append(rrs, d.from)
+			rrs = append(rrs, d.removed...)
+			rrs = append(rrs, d.to)
+			rrs = append(rrs, d.added...)
+		}
+		return append(rrs, z.soa)
+	}
+	return z.axfr()
+}
+
+// transfer answers an AXFR or IXFR request for zone.  Transfers are
+// only allowed from addresses in `allow_transfer`, and, if any TSIG
+// keys are configured, must be signed with one of them.
+func (s *DNSServer) transfer(w dns.ResponseWriter, r *dns.Msg, gen *memZones, zone *memZone) {
+	q := r.Question[0]
+	qtype := dns.TypeToString[q.Qtype]
+	remote := w.RemoteAddr()
+	fail := func(rcode int, format string, args ...interface{}) {
+		log.Warningf("Refused %s of %q from %v: %s", qtype, q.Name, remote, fmt.Sprintf(format, args...))
+		m := new(dns.Msg)
+		m.SetRcode(r, rcode)
+		if rcode != dns.RcodeNotAuth {
+			signReply(w, r, m)
+		}
+		w.WriteMsg(m)
+	}
+
+	addr, _ := netip.AddrFromSlice(remoteIP(remote))
+	switch {
+	case !gen.transfer.allowed(addr):
+		fail(dns.RcodeRefused, "not in allow_transfer")
+		return
+	case len(gen.transfer.keys) > 0 && r.IsTsig() == nil:
+		fail(dns.RcodeRefused, "not signed with a TSIG key")
+		return
+	case r.IsTsig() != nil && w.TsigStatus() != nil:
+		fail(dns.RcodeNotAuth, "TSIG: %v", w.TsigStatus())
+		return
+	case !strings.EqualFold(dns.Fqdn(q.Name), zone.name):
+		fail(dns.RcodeNotAuth, "not a zone")
+		return
+	}
+
+	var rrs []dns.RR
+	switch {
+	case q.Qtype == dns.TypeAXFR && remote.Network() == "udp":
+		fail(dns.RcodeFormatError, "AXFR needs TCP")
+		return
+	case q.Qtype == dns.TypeAXFR:
+		rrs = zone.axfr()
+	default:
+		var soa *dns.SOA
+		if len(r.Ns) == 1 {
+			soa, _ = r.Ns[0].(*dns.SOA)
+		}
+		if soa == nil {
+			fail(dns.RcodeFormatError, "no SOA in the authority section")
+			return
+		}
+		if zonefile.SerialGreater(soa.Serial, zone.soa.Serial) {
+			log.Warningf("%v has serial %d for %q, which is newer than %d; it won't be updated until the serial here passes it", remote, soa.Serial, q.Name, zone.soa.Serial)
+		}
+		rrs = zone.ixfr(soa.Serial)
+		if remote.Network() == "udp" && len(rrs) > 1 {
+			// Tell the secondary to retry over TCP.
+			rrs = []dns.RR{zone.soa}
+		}
+	}
+
+	ch := make(chan *dns.Envelope, len(rrs)/transferBatch+1)
+	for len(rrs) > 0 {
+		n := min(len(rrs), transferBatch)
+		ch <- &dns.Envelope{RR: rrs[:n]}
+		rrs = rrs[n:]
+	}
+	close(ch)
+	if err := new(dns.Transfer).Out(w, r, ch); err != nil {
+		log.Errorf("%s of %q to %v failed: %v", qtype, q.Name, remote, err)
+		return
+	}
+	log.Infof("Sent %s of %q with serial %d to %v", qtype, q.Name, zone.soa.Serial, remote)
+}
+
+// remoteIP returns the IP address from a client's address.
+func remoteIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// signReply signs m with the same TSIG key as the request it answers,
+// if the request was signed and the signature was valid.
+func signReply(w dns.ResponseWriter, r, m *dns.Msg) {
+	if tsig := r.IsTsig(); tsig != nil && w.TsigStatus() == nil {
+		m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsigFudge, time.Now().Unix())
+	}
+}
+
+// Generate implements dns.TsigProvider, signing messages with the keys
+// in `dns_server.tsig_keys`.
+func (s *DNSServer) Generate(msg []byte, t *dns.TSIG) ([]byte, error) {
+	key := s.zones.Load().transfer.keys[strings.ToLower(t.Hdr.Name)]
+	if key == nil {
+		return nil, dns.ErrSecret
+	}
+	if dns.CanonicalName(t.Algorithm) != key.algorithm {
+		return nil, dns.ErrKeyAlg
+	}
+	h := hmac.New(tsigAlgorithms[key.algorithm], key.secret)
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
+
+// Verify implements dns.TsigProvider, checking signatures made with
+// the keys in `dns_server.tsig_keys`.
+func (s *DNSServer) Verify(msg []byte, t *dns.TSIG) error {
+	want, err := s.Generate(msg, t)
+	if err != nil {
+		return err
+	}
+	mac, err := hex.DecodeString(t.MAC)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(want, mac) {
+		return dns.ErrSig
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package netbox2dns
+
+import (
+	"net/netip"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/scottlaird/netbox2dns/netboxlib"
+	"github.com/scottlaird/netbox2dns/zonefile"
+)
+
+func TestNewTransferConfig(t *testing.T) {
+	cfg := &Config{}
+	cfg.DNSServer.AllowTransfer = []string{"192.0.2.53", "2001:db8::/64", "bogus"}
+	cfg.DNSServer.TSIGKeys = []*ConfigTSIGKey{
+		{Name: "xfer", Algorithm: "hmac-sha256", Secret: "c2VjcmV0"},
+		{Name: "bad-secret", Algorithm: "hmac-sha256", Secret: "not base64!"},
+		{Name: "bad-algorithm", Algorithm: "hmac-md5", Secret: "c2VjcmV0"},
+		{Name: "XFER.", Algorithm: "hmac-sha512", Secret: "c2VjcmV0"},
+	}
+
+	tc, err := newTransferConfig(cfg)
+	if err == nil {
+		t.Errorf("newTransferConfig() with invalid settings didn't return an error")
+	}
+	if len(tc.acl) != 2 || len(tc.keys) != 1 || tc.keys["xfer."] == nil {
+		t.Fatalf("newTransferConfig(): got ACL %v and keys %v, want the valid entries", tc.acl, tc.keys)
+	}
+
+	for addr, want := range map[string]bool{
+		"192.0.2.53":          true,
+		"::ffff:192.0.2.53":   true,
+		"192.0.2.54":          false,
+		"2001:db8::53":        true,
+		"2001:db8:0:1::53":    false,
+		"2001:db8::ffff:1234": true,
+	} {
+		if got := tc.allowed(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("allowed(%s): got %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestZoneTransfers(t *testing.T) {
+	s := newTestDNSServer(t, filepath.Join(t.TempDir(), "serials.json"))
+	addr := startDNSServer(t, s)
+
+	cfg := &Config{}
+	cfg.DNSServer.AllowTransfer = []string{"127.0.0.0/8"}
+	tc, err := newTransferConfig(cfg)
+	if err != nil {
+		t.Fatalf("newTransferConfig() returned an error: %v", err)
+	}
+	s.zones.Store(&memZones{zones: map[string]*memZone{}, transfer: tc})
+
+	// Three versions of the zone, with serials 1, 2, and 3.
+	addrs := []netboxlib.IpamIPAddress{
+		{Address: netip.MustParseAddr("10.0.0.1"), DNSName: "a.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("10.0.0.2"), DNSName: "ns1.example.com", Status: "active"},
+	}
+	loadTestZones(t, s, addrs)
+	addrs[0].Address = netip.MustParseAddr("10.0.0.11")
+	loadTestZones(t, s, addrs)
+	addrs = append(addrs, netboxlib.IpamIPAddress{Address: netip.MustParseAddr("10.0.0.3"), DNSName: "b.example.com", Status: "active"})
+	loadTestZones(t, s, addrs)
+
+	transfer := func(m *dns.Msg, tr *dns.Transfer) ([]dns.RR, error) {
+		t.Helper()
+		ch, err := tr.In(m, addr)
+		if err != nil {
+			return nil, err
+		}
+		var rrs []dns.RR
+		for env := range ch {
+			if env.Error != nil {
+				return nil, env.Error
+			}
+			rrs = append(rrs, env.RR...)
+		}
+		return rrs, nil
+	}
+	serials := func(rrs []dns.RR) []uint32 {
+		var serials []uint32
+		for _, rr := range rrs {
+			if soa, ok := rr.(*dns.SOA); ok {
+				serials = append(serials, soa.Serial)
+			}
+		}
+		return serials
+	}
+
+	m := new(dns.Msg)
+	m.SetAxfr("example.com.")
+	rrs, err := transfer(m, &dns.Transfer{})
+	if err != nil {
+		t.Fatalf("AXFR failed: %v", err)
+	}
+	zone := s.zones.Load().zones["example.com."]
+	if len(rrs) != len(zone.records)+2 || len(serials(rrs)) != 2 || serials(rrs)[0] != 3 {
+		t.Errorf("AXFR: got %d records with serials %v, want %d records between two SOAs with serial 3", len(rrs), serials(rrs), len(zone.records)+2)
+	}
+
+	// IXFR from serial 1 sends both changes.
+	m.SetIxfr("example.com.", 1, "ns1.example.com.", "hostmaster.example.com.")
+	rrs, err = transfer(m, &dns.Transfer{})
+	if err != nil {
+		t.Fatalf("IXFR failed: %v", err)
+	}
+	var got []string
+	for _, rr := range rrs {
+		if _, ok := rr.(*dns.SOA); !ok {
+			got = append(got, rr.String())
+		}
+	}
+	want := []string{
+		"a.example.com.\t300\tIN\tA\t10.0.0.1",
+		"a.example.com.\t300\tIN\tA\t10.0.0.11",
+		"b.example.com.\t300\tIN\tA\t10.0.0.3",
+	}
+	wantSerials := []uint32{3, 1, 2, 2, 3, 3}
+	if len(got) != len(want) || len(serials(rrs)) != len(wantSerials) {
+		t.Fatalf("IXFR from 1: got %v, want %v with serials %v", rrs, want, wantSerials)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("IXFR from 1: record %d is %q, want %q", i, got[i], want[i])
+		}
+	}
+	for i, s := range serials(rrs) {
+		if s != wantSerials[i] {
+			t.Errorf("IXFR from 1: got serials %v, want %v", serials(rrs), wantSerials)
+			break
+		}
+	}
+
+	// Secondaries that are up to date just get the SOA, and ones
+	// older than the history get a full transfer.
+	m.SetIxfr("example.com.", 3, "ns1.example.com.", "hostmaster.example.com.")
+	if rrs, err := transfer(m, &dns.Transfer{}); err != nil || len(rrs) != 1 {
+		t.Errorf("IXFR from 3: got %v, %v; want just the SOA", rrs, err)
+	}
+	m.SetIxfr("example.com.", 0, "ns1.example.com.", "hostmaster.example.com.")
+	if rrs, err := transfer(m, &dns.Transfer{}); err != nil || len(rrs) != len(zone.records)+2 {
+		t.Errorf("IXFR from 0: got %d records, %v; want a full transfer", len(rrs), err)
+	}
+
+	// IXFR over UDP tells the secondary to use TCP.
+	m.SetIxfr("example.com.", 1, "ns1.example.com.", "hostmaster.example.com.")
+	resp, _, err := (&dns.Client{}).Exchange(m, addr)
+	if err != nil || len(resp.Answer) != 1 || serials(resp.Answer)[0] != 3 {
+		t.Errorf("IXFR over UDP: got %v, %v; want the current SOA", resp, err)
+	}
+
+	// Only allowed addresses may transfer zones.
+	cfg.DNSServer.AllowTransfer = []string{"192.0.2.0/24"}
+	cfg.DNSServer.TSIGKeys = []*ConfigTSIGKey{{Name: "xfer", Algorithm: "hmac-sha256", Secret: "c2VjcmV0"}}
+	setTransfer := func() {
+		tc, err := newTransferConfig(cfg)
+		if err != nil {
+			t.Fatalf("newTransferConfig() returned an error: %v", err)
+		}
+		gen := *s.zones.Load()
+		gen.transfer = tc
+		s.zones.Store(&gen)
+	}
+	setTransfer()
+	m.SetAxfr("example.com.")
+	if _, err := transfer(m, &dns.Transfer{}); err == nil {
+		t.Errorf("AXFR from an address that isn't allowed succeeded")
+	}
+
+	// With TSIG keys, transfers must be signed.
+	cfg.DNSServer.AllowTransfer = []string{"127.0.0.1", "::1"}
+	setTransfer()
+	if _, err := transfer(m, &dns.Transfer{}); err == nil {
+		t.Errorf("Unsigned AXFR succeeded")
+	}
+	m.SetTsig("xfer.", dns.HmacSHA256, 300, 0)
+	if _, err := transfer(m, &dns.Transfer{TsigSecret: map[string]string{"xfer.": "d3Jvbmc="}}); err == nil {
+		t.Errorf("AXFR signed with the wrong secret succeeded")
+	}
+	m.SetTsig("xfer.", dns.HmacSHA256, 300, 0)
+	if rrs, err := transfer(m, &dns.Transfer{TsigSecret: map[string]string{"xfer.": "c2VjcmV0"}}); err != nil || len(rrs) != len(zone.records)+2 {
+		t.Errorf("Signed AXFR: got %d records, %v; want a full transfer", len(rrs), err)
+	}
+}
+
+func TestZoneTransfersAfterRestart(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "serials.json")
+	addrs := []netboxlib.IpamIPAddress{
+		{Address: netip.MustParseAddr("10.0.0.1"), DNSName: "a.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("10.0.0.2"), DNSName: "ns1.example.com", Status: "active"},
+	}
+	cfg := &Config{}
+	cfg.DNSServer.AllowTransfer = []string{"127.0.0.0/8"}
+	tc, err := newTransferConfig(cfg)
+	if err != nil {
+		t.Fatalf("newTransferConfig() returned an error: %v", err)
+	}
+
+	// A secondary copies serial 3 from the first server.
+	s := newTestDNSServer(t, filename)
+	s.zones.Store(&memZones{zones: map[string]*memZone{}, transfer: tc})
+	for _, a := range []string{"10.0.0.1", "10.0.0.11", "10.0.0.21"} {
+		addrs[0].Address = netip.MustParseAddr(a)
+		loadTestZones(t, s, addrs)
+	}
+	secondary := s.zones.Load().zones["example.com."].soa.Serial
+	if secondary != 3 {
+		t.Fatalf("Serial before the restart: got %d, want 3", secondary)
+	}
+
+	// After a restart, the server has no history, but its serial
+	// is still higher than the secondary's, so the secondary gets a
+	// full transfer instead of being told that it's up to date.
+	s = newTestDNSServer(t, filename)
+	s.zones.Store(&memZones{zones: map[string]*memZone{}, transfer: tc})
+	addr := startDNSServer(t, s)
+	loadTestZones(t, s, addrs)
+	zone := s.zones.Load().zones["example.com."]
+	if !zonefile.SerialGreater(zone.soa.Serial, secondary) {
+		t.Fatalf("Serial after the restart: got %d, want more than %d", zone.soa.Serial, secondary)
+	}
+
+	m := new(dns.Msg)
+	m.SetIxfr("example.com.", secondary, "ns1.example.com.", "hostmaster.example.com.")
+	ch, err := new(dns.Transfer).In(m, addr)
+	if err != nil {
+		t.Fatalf("IXFR failed: %v", err)
+	}
+	var rrs []dns.RR
+	for env := range ch {
+		if env.Error != nil {
+			t.Fatalf("IXFR failed: %v", env.Error)
+		}
+		rrs = append(rrs, env.RR...)
+	}
+	if len(rrs) != len(zone.records)+2 || rrs[0].(*dns.SOA).Serial != zone.soa.Serial {
+		t.Errorf("IXFR from %d after a restart: got %v, want a full transfer with serial %d", secondary, rrs, zone.soa.Serial)
+	}
+
+	// A secondary that's somehow ahead of the server can only be
+	// told the current serial.
+	m.SetIxfr("example.com.", zone.soa.Serial+100, "ns1.example.com.", "hostmaster.example.com.")
+	ch, err = new(dns.Transfer).In(m, addr)
+	if err != nil {
+		t.Fatalf("IXFR failed: %v", err)
+	}
+	rrs = nil
+	for env := range ch {
+		rrs = append(rrs, env.RR...)
+	}
+	if len(rrs) != 1 {
+		t.Errorf("IXFR from a newer serial: got %v, want just the SOA", rrs)
+	}
+}
@@ -0,0 +1,27 @@
+package netbox2dns
+
+import "runtime/debug"
+
+// Version is netbox2dns's version.  Release builds may set it with
+// `-ldflags "-X github.com/scottlaird/netbox2dns.Version=v1.2.3"`;
+// otherwise it's taken from the build info when possible.
+var Version = ""
+
+// version returns Version, or the module version recorded in the
+// binary, or "devel" if neither is known.
+func version() string {
+	if Version != "" {
+		return Version
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range bi.Deps {
+			if dep.Path == "github.com/scottlaird/netbox2dns" && dep.Version != "" {
+				return dep.Version
+			}
+		}
+		if bi.Main.Path == "github.com/scottlaird/netbox2dns" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			return bi.Main.Version
+		}
+	}
+	return "devel"
+}
@@ -0,0 +1,204 @@
+package netbox2dns
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// Defaults used when the webhook settings can't be parsed.  These
+// match the defaults in `config.cue`.
+const (
+	defaultDebounce = 5 * time.Second
+
+	// maxWebhookSize limits the size of webhook requests.  IP
+	// address payloads from NetBox are only a few KB.
+	maxWebhookSize = 1 << 20
+)
+
+// WebhookPayload is the subset of NetBox's webhook payload that
+// netbox2dns uses.
+type WebhookPayload struct {
+	Event     string           `json:"event"`
+	Model     string           `json:"model"`
+	Data      webhookIPAddress `json:"data"`
+	Snapshots struct {
+		Prechange  *webhookIPAddress `json:"prechange"`
+		Postchange *webhookIPAddress `json:"postchange"`
+	} `json:"snapshots"`
+}
+
+// webhookIPAddress holds the fields of an IP address object that
+// affect DNS.
+type webhookIPAddress struct {
+	Address string `json:"address"`
+	DNSName string `json:"dns_name"`
+}
+
+// WebhookHandler receives NetBox webhooks for IP address changes and
+// triggers a sync of the affected zones.  Webhooks that arrive within
+// `daemon.webhook.debounce` of the first one are merged into a single
+// sync.
+type WebhookHandler struct {
+	daemon *Daemon
+
+	mu      sync.Mutex // protects pending and timer
+	pending map[string]bool
+	timer   *time.Timer
+
+	// trigger is called with the affected zones once the debounce
+	// delay has passed.  It's replaceable for tests.
+	trigger func(zones []string)
+}
+
+// NewWebhookHandler creates a WebhookHandler that triggers syncs on d.
+func NewWebhookHandler(d *Daemon) *WebhookHandler {
+	return &WebhookHandler{
+		daemon:  d,
+		pending: make(map[string]bool),
+		trigger: d.TriggerZones,
+	}
+}
+
+// ServeHTTP handles a single webhook request from NetBox.
+func (wh *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg := wh.daemon.Config()
+	secret := cfg.Daemon.Webhook.Secret
+	if secret == "" {
+		http.Error(w, "webhooks are not configured", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		http.Error(w, "unable to read request", http.StatusBadRequest)
+		return
+	}
+
+	if !validSignature(secret, body, r.Header.Get("X-Hook-Signature")) {
+		log.Warningf("Rejecting webhook from %s with invalid signature", r.RemoteAddr)
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	payload := &WebhookPayload{}
+	err = json.Unmarshal(body, payload)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid payload: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if payload.Model != "ipaddress" && payload.Model != "ipam.ipaddress" {
+		log.Infof("Ignoring webhook for model %q", payload.Model)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	zones := NewZones()
+	for _, cz := range wh.daemon.zones() {
+		zones.NewZone(cz)
+	}
+	affected := payload.affectedZones(zones)
+	log.Infof("Webhook %s for %q affects zones %v", payload.Event, payload.Data.Address, affected)
+
+	wh.queue(affected, parseDurationOr(cfg.Daemon.Webhook.Debounce, defaultDebounce))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// queue adds zones to the pending set, and starts the debounce timer
+// if it isn't already running.
+func (wh *WebhookHandler) queue(zones []string, debounce time.Duration) {
+	if len(zones) == 0 {
+		return
+	}
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	for _, z := range zones {
+		wh.pending[z] = true
+	}
+	if wh.timer == nil {
+		wh.timer = time.AfterFunc(debounce, wh.flush)
+	}
+}
+
+// flush triggers a sync of all pending zones.
+func (wh *WebhookHandler) flush() {
+	wh.mu.Lock()
+	zones := make([]string, 0, len(wh.pending))
+	for z := range wh.pending {
+		zones = append(zones, z)
+	}
+	wh.pending = make(map[string]bool)
+	wh.timer = nil
+	wh.mu.Unlock()
+
+	sort.Strings(zones)
+	wh.trigger(zones)
+}
+
+// validSignature checks NetBox's `X-Hook-Signature` header, which is
+// the hex-encoded HMAC-SHA512 of the request body.
+func validSignature(secret string, body []byte, signature string) bool {
+	got, err := hex.DecodeString(strings.TrimSpace(signature))
+	if err != nil || len(got) == 0 {
+		return false
+	}
+
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// affectedZones returns the names of the zones whose records could be
+// changed by this webhook.  Both the old and new versions of the IP
+// address are considered, so that renames and address changes remove
+// the old records as well as adding the new ones.
+func (p *WebhookPayload) affectedZones(zones *Zones) []string {
+	objs := []*webhookIPAddress{&p.Data}
+	if p.Snapshots.Prechange != nil {
+		objs = append(objs, p.Snapshots.Prechange)
+	}
+	if p.Snapshots.Postchange != nil {
+		objs = append(objs, p.Snapshots.Postchange)
+	}
+
+	found := map[string]bool{}
+	for _, obj := range objs {
+		if obj.DNSName != "" {
+			if zone := zones.ZoneFor(obj.DNSName + "."); zone != nil {
+				found[zone.Name] = true
+			}
+		}
+		if prefix, err := netip.ParsePrefix(obj.Address); err == nil {
+			ptr := &Record{Name: ReverseName(prefix.Addr()), Type: "PTR", Addr: prefix.Addr()}
+			if zone, _ := zones.ZoneForRecord(ptr); zone != nil {
+				found[zone.Name] = true
+			}
+		}
+	}
+
+	ret := make([]string, 0, len(found))
+	for z := range found {
+		ret = append(ret, z)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,145 @@
+package netbox2dns
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "0123456789abcdef"
+
+// newTestWebhookServer starts an httptest server for a
+// WebhookHandler.  Triggered zone lists are sent to the returned
+// channel.
+func newTestWebhookServer(t *testing.T) (*httptest.Server, chan []string) {
+	cfg, err := ParseConfig("testdata/config4/conf.yaml")
+	if err != nil {
+		t.Fatalf("Unable to parse config: %v", err)
+	}
+	cfg.Daemon.Webhook.Secret = testWebhookSecret
+	cfg.Daemon.Webhook.Debounce = "50ms"
+
+	d := newTestDaemon(nil)
+	d.cfg = cfg
+
+	triggered := make(chan []string, 10)
+	wh := NewWebhookHandler(d)
+	wh.trigger = func(zones []string) { triggered <- zones }
+
+	server := httptest.NewServer(wh)
+	t.Cleanup(server.Close)
+	return server, triggered
+}
+
+// postWebhook posts a recorded payload from testdata/webhook, signed
+// with secret.
+func postWebhook(t *testing.T, url, file, secret string) int {
+	body, err := os.ReadFile("testdata/webhook/" + file)
+	if err != nil {
+		t.Fatalf("Unable to read %q: %v", file, err)
+	}
+
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write(body)
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Unable to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Hook-Signature", hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unable to post webhook: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestWebhookSignature(t *testing.T) {
+	server, triggered := newTestWebhookServer(t)
+
+	if got := postWebhook(t, server.URL, "ipaddress_created.json", "wrong"); got != http.StatusForbidden {
+		t.Errorf("webhook with bad signature: got status %d, want %d", got, http.StatusForbidden)
+	}
+
+	select {
+	case zones := <-triggered:
+		t.Errorf("webhook with bad signature triggered a sync of %v", zones)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestWebhookAffectedZones(t *testing.T) {
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{"ipaddress_created.json", []string{"10.in-addr.arpa", "internal.example.com"}},
+		{"ipaddress_updated.json", []string{"10.in-addr.arpa", "example.com", "internal.example.com"}},
+		{"ipaddress_deleted.json", []string{"10.in-addr.arpa", "internal.example.com"}},
+	}
+
+	for _, test := range tests {
+		server, triggered := newTestWebhookServer(t)
+
+		if got := postWebhook(t, server.URL, test.file, testWebhookSecret); got != http.StatusAccepted {
+			t.Errorf("%s: got status %d, want %d", test.file, got, http.StatusAccepted)
+			continue
+		}
+
+		select {
+		case zones := <-triggered:
+			if !reflect.DeepEqual(zones, test.want) {
+				t.Errorf("%s: triggered %v, want %v", test.file, zones, test.want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Errorf("%s: no sync triggered", test.file)
+		}
+	}
+}
+
+func TestWebhookIgnoresOtherModels(t *testing.T) {
+	server, triggered := newTestWebhookServer(t)
+
+	if got := postWebhook(t, server.URL, "device_updated.json", testWebhookSecret); got != http.StatusNoContent {
+		t.Errorf("device webhook: got status %d, want %d", got, http.StatusNoContent)
+	}
+
+	select {
+	case zones := <-triggered:
+		t.Errorf("device webhook triggered a sync of %v", zones)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestWebhookDebounce(t *testing.T) {
+	server, triggered := newTestWebhookServer(t)
+
+	postWebhook(t, server.URL, "ipaddress_created.json", testWebhookSecret)
+	postWebhook(t, server.URL, "ipaddress_updated.json", testWebhookSecret)
+
+	want := []string{"10.in-addr.arpa", "example.com", "internal.example.com"}
+	select {
+	case zones := <-triggered:
+		if !reflect.DeepEqual(zones, want) {
+			t.Errorf("triggered %v, want %v", zones, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no sync triggered")
+	}
+
+	select {
+	case zones := <-triggered:
+		t.Errorf("second sync triggered for %v, want a single debounced sync", zones)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
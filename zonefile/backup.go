@@ -0,0 +1,290 @@
+package zonefile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BackupTimeFormat is the format of the timestamps in backup
+// filenames.  Timestamps are in UTC.
+const BackupTimeFormat = "20060102T150405Z"
+
+// Backup describes where the previous versions of a zone file are
+// kept.  Each version is named for the time it was written, like
+// "20240102T030405Z.zone", plus ".gz" if it's compressed.
+type Backup struct {
+	Dir  string // Directory for this zone's backups; it's created if needed
+	Keep int    // Number of backups to keep; older ones are deleted
+	Gzip bool   // Compress new backups
+}
+
+// BackupFile is a single backup of a zone file.
+type BackupFile struct {
+	Timestamp string // When the backed-up version was written, in BackupTimeFormat
+	Time      time.Time
+	Path      string
+}
+
+// List returns the zone's backups, oldest first.  A missing backup
+// directory has no backups.
+func (b *Backup) List() ([]BackupFile, error) {
+	entries, err := os.ReadDir(b.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []BackupFile
+	for _, e := range entries {
+		name := e.Name()
+		stamp, ok := strings.CutSuffix(strings.TrimSuffix(name, ".gz"), ".zone")
+		if !ok || e.IsDir() {
+			continue
+		}
+		t, err := time.Parse(BackupTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		files = append(files, BackupFile{Timestamp: stamp, Time: t, Path: filepath.Join(b.Dir, name)})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Time.Before(files[j].Time) })
+	return files, nil
+}
+
+// Find returns the backup with the given timestamp, or the newest
+// backup if timestamp is "".  Timestamps may be in BackupTimeFormat
+// or RFC 3339.
+func (b *Backup) Find(timestamp string) (BackupFile, error) {
+	files, err := b.List()
+	if err != nil {
+		return BackupFile{}, err
+	}
+	if len(files) == 0 {
+		return BackupFile{}, fmt.Errorf("No backups found in %q", b.Dir)
+	}
+	if timestamp == "" {
+		return files[len(files)-1], nil
+	}
+
+	t, err := time.Parse(BackupTimeFormat, timestamp)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, timestamp)
+	}
+	if err != nil {
+		return BackupFile{}, fmt.Errorf("Invalid timestamp %q; use the format %s", timestamp, BackupTimeFormat)
+	}
+	for _, f := range files {
+		if f.Time.Equal(t) {
+			return f, nil
+		}
+	}
+	return BackupFile{}, fmt.Errorf("No backup from %s in %q", t.UTC().Format(BackupTimeFormat), b.Dir)
+}
+
+// save copies filename into the backup directory, named for the
+// time it was last modified, and then deletes the oldest backups
+// beyond Keep.  It does nothing if filename doesn't exist.
+func (b *Backup) save(filename string) error {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	name := info.ModTime().UTC().Format(BackupTimeFormat) + ".zone"
+	if b.Gzip {
+		name += ".gz"
+	}
+
+	err = WriteFileAtomic(filepath.Join(b.Dir, name), func(w io.Writer) error {
+		if !b.Gzip {
+			_, err := io.Copy(w, f)
+			return err
+		}
+		gz := gzip.NewWriter(w)
+		if _, err := io.Copy(gz, f); err != nil {
+			return err
+		}
+		return gz.Close()
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to back up %q: %w", filename, err)
+	}
+	return b.prune()
+}
+
+// prune deletes the oldest backups, leaving Keep of them.
+func (b *Backup) prune() error {
+	if b.Keep <= 0 {
+		return nil
+	}
+	files, err := b.List()
+	if err != nil {
+		return err
+	}
+	for len(files) > b.Keep {
+		if err := os.Remove(files[0].Path); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// read returns the contents of a backup, decompressing it if needed.
+func (f BackupFile) read() ([]byte, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil || !strings.HasSuffix(f.Path, ".gz") {
+		return data, err
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Path, err)
+	}
+	defer gz.Close()
+	return io.ReadAll(gz)
+}
+
+// Restore replaces the zone's file with the backup with the given
+// timestamp, or the newest backup if timestamp is "".  The current
+// file is backed up first, so a restore can be undone.  The restored
+// zone must pass Check.  For zones with an SOA, the restored zone
+// gets a new serial, so secondaries see the change.
+func (z *Zone) Restore(timestamp string) (BackupFile, Changes, error) {
+	if z.Backup == nil {
+		return BackupFile{}, Changes{}, fmt.Errorf("No backup directory for %q", z.Filename)
+	}
+	file, err := z.Backup.Find(timestamp)
+	if err != nil {
+		return file, Changes{}, err
+	}
+	data, err := file.read()
+	if err != nil {
+		return file, Changes{}, err
+	}
+
+	origin := z.Origin
+	var serial uint32
+	if z.SOA != nil {
+		if origin == "" {
+			origin = z.SOA.Name
+		}
+		prev, hasPrev := z.previousSerial()
+		serial, err = NextSerial(z.SOA.SerialStrategy, prev, hasPrev, time.Now())
+		if err != nil {
+			return file, Changes{}, err
+		}
+		data, err = replaceSerial(data, serial)
+		if err != nil {
+			return file, Changes{}, fmt.Errorf("%s: %w", file.Path, err)
+		}
+	}
+
+	rrs, err := Parse(bytes.NewReader(data), origin)
+	if err != nil {
+		return file, Changes{}, fmt.Errorf("%s: %w", file.Path, err)
+	}
+	var records []ResourceRecord
+	for _, rr := range rrs {
+		if rr.Type != "SOA" {
+			records = append(records, rr)
+		}
+	}
+	err = Check(rrs, origin, z.SOA != nil)
+	if err != nil {
+		return file, Changes{}, err
+	}
+
+	// countChanges compares the zone's records with its file, so
+	// use the restored records for this.
+	restored := *z
+	restored.ResourceRecords = records
+	changes := restored.countChanges()
+	changes.Changed = true
+	changes.Serial = serial
+
+	err = z.Backup.save(z.Filename)
+	if err != nil {
+		return file, Changes{}, err
+	}
+	err = WriteFileAtomic(z.Filename, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		return file, Changes{}, err
+	}
+	return file, changes, nil
+}
+
+// replaceSerial replaces the serial in the first SOA record in data,
+// which must be on a single line, as Save writes it.
+func replaceSerial(data []byte, serial uint32) ([]byte, error) {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	replaced := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !replaced {
+			if l, ok := replaceLineSerial(line, serial); ok {
+				line = l
+				replaced = true
+			}
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !replaced {
+		return nil, fmt.Errorf("No SOA record found")
+	}
+	return out.Bytes(), nil
+}
+
+// replaceLineSerial replaces the serial in line, if it's an SOA
+// record.  The rest of the line, including its spacing, is kept.
+func replaceLineSerial(line string, serial uint32) (string, bool) {
+	if strings.HasPrefix(line, ";") {
+		return line, false
+	}
+	fields := strings.Fields(line)
+	for i, f := range fields {
+		if !strings.EqualFold(f, "SOA") || i+3 >= len(fields) {
+			continue
+		}
+		if _, err := strconv.ParseUint(fields[i+3], 10, 32); err != nil {
+			continue
+		}
+		// Find the serial's position in the original line.
+		pos := 0
+		for j := 0; j <= i+3; j++ {
+			pos += strings.Index(line[pos:], fields[j])
+			if j < i+3 {
+				pos += len(fields[j])
+			}
+		}
+		return line[:pos] + strconv.FormatUint(uint64(serial), 10) + line[pos+len(fields[i+3]):], true
+	}
+	return line, false
+}
@@ -0,0 +1,146 @@
+package zonefile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackups(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "example.com.zone")
+	backup := &Backup{Dir: filepath.Join(dir, "backups", "example.com"), Keep: 2, Gzip: true}
+
+	// Each version is written an hour after the previous one, so
+	// that backups get distinct names.
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	save := func(i int, addr string) {
+		z, err := New(filename)
+		if err != nil {
+			t.Fatalf("New() returned an error: %v", err)
+		}
+		z.Backup = backup
+		z.Add(ResourceRecord{Name: "a.example.com.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{addr}})
+		if _, err := z.Save(); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+		mtime := start.Add(time.Duration(i) * time.Hour)
+		if err := os.Chtimes(filename, mtime, mtime); err != nil {
+			t.Fatalf("Chtimes() returned an error: %v", err)
+		}
+	}
+	save(0, "10.0.0.1")
+	save(1, "10.0.0.2")
+	save(2, "10.0.0.3")
+	save(3, "10.0.0.4")
+
+	files, err := backup.List()
+	if err != nil {
+		t.Fatalf("List() returned an error: %v", err)
+	}
+	var stamps []string
+	for _, f := range files {
+		stamps = append(stamps, f.Timestamp)
+	}
+	if got, want := strings.Join(stamps, " "), "20240102T040405Z 20240102T050405Z"; got != want {
+		t.Fatalf("List() returned backups %q, want %q", got, want)
+	}
+	if !strings.HasSuffix(files[0].Path, ".zone.gz") {
+		t.Errorf("backup %q isn't compressed", files[0].Path)
+	}
+
+	z, err := New(filename)
+	if err != nil {
+		t.Fatalf("New() returned an error: %v", err)
+	}
+	z.Backup = backup
+	file, changes, err := z.Restore("2024-01-02T04:04:05Z")
+	if err != nil {
+		t.Fatalf("Restore() returned an error: %v", err)
+	}
+	if file.Timestamp != "20240102T040405Z" {
+		t.Errorf("Restore() restored %q, want 20240102T040405Z", file.Timestamp)
+	}
+	if want := (Changes{Changed: true, Added: 1, Removed: 1}); changes != want {
+		t.Errorf("Restore() returned changes %+v, want %+v", changes, want)
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Unable to read zone file: %v", err)
+	}
+	if want := "a.example.com. 300 IN A 10.0.0.2\n"; string(b) != want {
+		t.Errorf("restored zone file: got %q, want %q", string(b), want)
+	}
+
+	// The version that was replaced should now be the newest backup.
+	file, err = backup.Find("")
+	if err != nil {
+		t.Fatalf("Find() returned an error: %v", err)
+	}
+	if file.Timestamp != "20240102T060405Z" {
+		t.Errorf("newest backup after Restore(): got %q, want 20240102T060405Z", file.Timestamp)
+	}
+
+	if _, _, err := z.Restore("20230101T000000Z"); err == nil {
+		t.Errorf("Restore() of a missing backup didn't return an error")
+	}
+}
+
+func TestRestoreSOA(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "example.com.zone")
+
+	newZone := func() *Zone {
+		z, err := New(filename)
+		if err != nil {
+			t.Fatalf("New() returned an error: %v", err)
+		}
+		z.Format = FormatPretty
+		z.Origin = "example.com."
+		z.DefaultTTL = 300
+		z.Backup = &Backup{Dir: filepath.Join(dir, "backups"), Keep: 5}
+		z.SOA = &SOA{
+			Name: "example.com.", TTL: 300,
+			MName: "ns1.example.com.", RName: "hostmaster.example.com.",
+			Refresh: 3600, Retry: 600, Expire: 1209600, Minimum: 300,
+			SerialStrategy: SerialIncrement,
+		}
+		z.Add(ResourceRecord{Name: "example.com.", Type: "NS", Class: "IN", TTL: 300, Rdata: []string{"ns1.example.com."}})
+		return z
+	}
+
+	z := newZone()
+	z.Add(ResourceRecord{Name: "a.example.com.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{"10.0.0.1"}})
+	if _, err := z.Save(); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filename, old, old); err != nil {
+		t.Fatalf("Chtimes() returned an error: %v", err)
+	}
+	z = newZone()
+	z.Add(ResourceRecord{Name: "a.example.com.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{"10.0.0.2"}})
+	if _, err := z.Save(); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+
+	_, changes, err := newZone().Restore("")
+	if err != nil {
+		t.Fatalf("Restore() returned an error: %v", err)
+	}
+	if changes.Serial != 3 {
+		t.Errorf("Restore() changes.Serial: got %d, want 3", changes.Serial)
+	}
+	rrs, err := Load(filename, "example.com.")
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	if len(rrs) != 3 || rrs[0].Type != "SOA" || rrs[2].Rdata[0] != "10.0.0.1" {
+		t.Fatalf("restored zone: got %+v, want the first version", rrs)
+	}
+	if serial := strings.Fields(rrs[0].Rdata[0])[2]; serial != "3" {
+		t.Errorf("restored zone's serial: got %s, want 3", serial)
+	}
+}
@@ -0,0 +1,269 @@
+package zonefile
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// maxCheckProblems is the most problems listed in a CheckError's
+// message.
+const maxCheckProblems = 10
+
+// CheckError is returned by Check when a zone has problems.
+type CheckError struct {
+	Zone     string
+	Problems []string
+}
+
+func (e *CheckError) Error() string {
+	problems := e.Problems
+	more := ""
+	if len(problems) > maxCheckProblems {
+		more = fmt.Sprintf(" (and %d more)", len(problems)-maxCheckProblems)
+		problems = problems[:maxCheckProblems]
+	}
+	return fmt.Sprintf("Zone %q failed sanity checks: %s%s", e.Zone, strings.Join(problems, "; "), more)
+}
+
+// Check performs basic sanity checks on a zone's records, much like
+// `named-checkzone`:
+//
+//   - every record's rdata is valid for its type,
+//   - no name has a CNAME along with other records,
+//   - owner names are fully-qualified and inside the zone,
+//   - PTR targets are fully-qualified, and
+//   - if requireSOA is set, the zone's apex has an SOA record and at
+//     least one NS record.
+//
+// `origin` is the zone's name, with a trailing dot; if it's empty,
+// owner names aren't checked against it.  Check returns a *CheckError
+// listing every problem found, or nil.
+func Check(rrs []ResourceRecord, origin string, requireSOA bool) error {
+	var problems []string
+	problem := func(rr ResourceRecord, format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("%s %s: ", rr.Name, rr.Type)+fmt.Sprintf(format, args...))
+	}
+
+	types := map[string]map[string]int{}
+	for _, rr := range rrs {
+		switch {
+		case !strings.HasSuffix(rr.Name, "."):
+			problem(rr, "owner name isn't fully-qualified")
+		case origin != "" && !inZone(rr.Name, origin):
+			problem(rr, "owner name is outside of zone %q", origin)
+		case !validName(rr.Name):
+			problem(rr, "invalid owner name")
+		}
+		if rr.Class != "IN" {
+			problem(rr, "class %q isn't IN", rr.Class)
+		}
+		if len(rr.Rdata) == 0 {
+			problem(rr, "no data")
+		}
+		for _, rd := range rr.Rdata {
+			if err := checkRdata(rr.Type, rd); err != nil {
+				problem(rr, "%q: %v", rd, err)
+			}
+		}
+
+		name := strings.ToLower(rr.Name)
+		if types[name] == nil {
+			types[name] = map[string]int{}
+		}
+		types[name][rr.Type] += len(rr.Rdata)
+	}
+
+	for _, rr := range rrs {
+		t := types[strings.ToLower(rr.Name)]
+		if t == nil || t["CNAME"] == 0 {
+			continue
+		}
+		if len(t) > 1 || t["CNAME"] > 1 {
+			problem(rr, "CNAME can't coexist with other records")
+		}
+		delete(types, strings.ToLower(rr.Name)) // Only report each name once
+	}
+
+	if requireSOA {
+		apex := types[strings.ToLower(origin)]
+		if apex == nil || apex["SOA"] == 0 {
+			problems = append(problems, "no SOA record at the zone's apex")
+		} else if apex["SOA"] > 1 {
+			problems = append(problems, "more than one SOA record")
+		}
+		if apex == nil || apex["NS"] == 0 {
+			problems = append(problems, "no NS records at the zone's apex")
+		}
+	}
+
+	if len(problems) > 0 {
+		return &CheckError{Zone: strings.TrimSuffix(origin, "."), Problems: problems}
+	}
+	return nil
+}
+
+// Check runs Check on the zone's records, including its SOA record
+// if it has one.  Zones with an SOA must also have apex NS records.
+func (z *Zone) Check() error {
+	origin := z.Origin
+	rrs := z.ResourceRecords
+	if z.SOA != nil {
+		if origin == "" {
+			origin = z.SOA.Name
+		}
+		soa := ResourceRecord{Name: z.SOA.Name, Type: "SOA", Class: "IN", TTL: z.SOA.TTL, Rdata: []string{z.SOA.rdata(1)}}
+		rrs = append([]ResourceRecord{soa}, rrs...)
+	}
+	return Check(rrs, origin, z.SOA != nil)
+}
+
+// inZone returns true if name is origin, or below it.
+func inZone(name, origin string) bool {
+	if strings.EqualFold(name, origin) || origin == "." {
+		return true
+	}
+	i := len(name) - len(origin) - 1
+	return i > 0 && name[i] == '.' && strings.EqualFold(name[i+1:], origin)
+}
+
+// validName returns true if name looks like a domain name: labels of
+// 1 to 63 characters without whitespace or zone file syntax, up to
+// 255 characters in all.
+func validName(name string) bool {
+	if name == "." || name == "@" {
+		return true
+	}
+	if name == "" || len(name) > 255 || strings.ContainsAny(name, " \t\r\n\"();") {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkRdata checks that rdata is valid for records of type rtype.
+func checkRdata(rtype, rdata string) error {
+	fields, _, err := tokenize(rdata)
+	if err != nil {
+		return err
+	}
+
+	// want checks that there are exactly n fields.
+	want := func(n int) error {
+		if len(fields) != n {
+			return fmt.Errorf("%d fields, want %d", len(fields), n)
+		}
+		return nil
+	}
+	name := func(s string) error {
+		if !validName(s) {
+			return fmt.Errorf("invalid name %q", s)
+		}
+		return nil
+	}
+	number := func(s string, bits int) error {
+		if _, err := strconv.ParseUint(s, 10, bits); err != nil {
+			return fmt.Errorf("invalid %d-bit number %q", bits, s)
+		}
+		return nil
+	}
+	all := func(errs ...error) error {
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch rtype {
+	case "A", "AAAA":
+		if err := want(1); err != nil {
+			return err
+		}
+		addr, err := netip.ParseAddr(fields[0])
+		if err != nil || addr.Zone() != "" || addr.Is4() != (rtype == "A") || addr.Is4In6() {
+			return fmt.Errorf("invalid address for %s record", rtype)
+		}
+		return nil
+	case "CNAME", "NS":
+		return all(want(1), name(fields[0]))
+	case "PTR":
+		if err := all(want(1), name(fields[0])); err != nil {
+			return err
+		}
+		if !strings.HasSuffix(fields[0], ".") {
+			return fmt.Errorf("target isn't fully-qualified")
+		}
+		return nil
+	case "MX":
+		if err := want(2); err != nil {
+			return err
+		}
+		return all(number(fields[0], 16), name(fields[1]))
+	case "SRV":
+		if err := want(4); err != nil {
+			return err
+		}
+		return all(number(fields[0], 16), number(fields[1], 16), number(fields[2], 16), name(fields[3]))
+	case "TXT":
+		if len(fields) == 0 {
+			return fmt.Errorf("no strings")
+		}
+		for _, f := range fields {
+			if n := stringLength(f); n > 255 {
+				return fmt.Errorf("string is %d bytes long; the limit is 255", n)
+			}
+		}
+		return nil
+	case "CAA":
+		if err := want(3); err != nil {
+			return err
+		}
+		if err := number(fields[0], 8); err != nil {
+			return err
+		}
+		if fields[1] == "" || strings.Trim(fields[1], "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789") != "" {
+			return fmt.Errorf("invalid tag %q", fields[1])
+		}
+		return nil
+	case "SOA":
+		if err := want(7); err != nil {
+			return err
+		}
+		errs := []error{name(fields[0]), name(fields[1])}
+		for _, f := range fields[2:] {
+			errs = append(errs, number(f, 32))
+		}
+		return all(errs...)
+	default:
+		return fmt.Errorf("unsupported record type")
+	}
+}
+
+// stringLength returns the length of a character string from a zone
+// file once its quotes and escapes are removed.
+func stringLength(s string) int {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "\""), "\"")
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			if i+3 < len(s) && isDigit(s[i+1]) && isDigit(s[i+2]) && isDigit(s[i+3]) {
+				i += 3
+			} else {
+				i++
+			}
+		}
+		n++
+	}
+	return n
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,101 @@
+package zonefile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	rr := func(name, rtype, rdata string) ResourceRecord {
+		return ResourceRecord{Name: name, Type: rtype, Class: "IN", TTL: 300, Rdata: []string{rdata}}
+	}
+	soa := rr("example.com.", "SOA", "ns1.example.com. hostmaster.example.com. 1 3600 600 1209600 300")
+	ns := rr("example.com.", "NS", "ns1.example.com.")
+	good := []ResourceRecord{
+		soa,
+		ns,
+		rr("example.com.", "MX", "10 mail.example.com."),
+		rr("example.com.", "TXT", `"v=spf1 mx -all" "second \"string\""`),
+		rr("example.com.", "CAA", `0 issue "letsencrypt.org"`),
+		rr("a.example.com.", "A", "10.0.0.1"),
+		rr("a.example.com.", "AAAA", "2001:db8::1"),
+		rr("www.example.com.", "CNAME", "a.example.com."),
+		rr("_sip._tcp.example.com.", "SRV", "10 5 5060 sip.example.com."),
+		rr("*.lab.example.com.", "A", "10.0.0.2"),
+		rr("1.0.0.10.in-addr.arpa.", "PTR", "a.example.com."),
+	}
+
+	tests := []struct {
+		name       string
+		rrs        []ResourceRecord
+		requireSOA bool
+		want       string // Part of the expected problem, or "" for none
+	}{
+		{name: "PTR in a forward zone", rrs: good, want: "outside of zone"},
+		{name: "valid", rrs: good[:len(good)-1], requireSOA: true},
+		{name: "bad A", rrs: []ResourceRecord{rr("a.example.com.", "A", "2001:db8::1")}, want: "invalid address"},
+		{name: "bad AAAA", rrs: []ResourceRecord{rr("a.example.com.", "AAAA", "10.0.0.1")}, want: "invalid address"},
+		{name: "bad MX", rrs: []ResourceRecord{rr("example.com.", "MX", "mail.example.com.")}, want: "1 fields, want 2"},
+		{name: "bad SRV", rrs: []ResourceRecord{rr("_x._tcp.example.com.", "SRV", "10 5 99999 sip.example.com.")}, want: "invalid 16-bit number"},
+		{name: "long TXT", rrs: []ResourceRecord{rr("example.com.", "TXT", `"`+strings.Repeat("x", 256)+`"`)}, want: "256 bytes"},
+		{name: "bad CAA", rrs: []ResourceRecord{rr("example.com.", "CAA", `0 is-sue "ca.example"`)}, want: "invalid tag"},
+		{name: "unknown type", rrs: []ResourceRecord{rr("example.com.", "HINFO", `"a" "b"`)}, want: "unsupported"},
+		{name: "long label", rrs: []ResourceRecord{rr(strings.Repeat("x", 64)+".example.com.", "A", "10.0.0.1")}, want: "invalid owner name"},
+		{name: "relative owner", rrs: []ResourceRecord{rr("a", "A", "10.0.0.1")}, want: "isn't fully-qualified"},
+		{name: "outside zone", rrs: []ResourceRecord{rr("a.example.net.", "A", "10.0.0.1")}, want: "outside of zone"},
+		{name: "relative PTR", rrs: []ResourceRecord{rr("1.example.com.", "PTR", "a.example.com")}, want: "isn't fully-qualified"},
+		{name: "CNAME and A", rrs: []ResourceRecord{rr("www.example.com.", "CNAME", "a.example.com."), rr("WWW.example.com.", "A", "10.0.0.1")}, want: "CNAME can't coexist"},
+		{name: "two CNAMEs", rrs: []ResourceRecord{{Name: "www.example.com.", Type: "CNAME", Class: "IN", Rdata: []string{"a.example.com.", "b.example.com."}}}, want: "CNAME can't coexist"},
+		{name: "no SOA", rrs: []ResourceRecord{ns}, requireSOA: true, want: "no SOA record"},
+		{name: "no NS", rrs: []ResourceRecord{soa}, requireSOA: true, want: "no NS records"},
+	}
+
+	for _, test := range tests {
+		err := Check(test.rrs, "example.com.", test.requireSOA)
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("%s: Check() returned an error: %v", test.name, err)
+			}
+			continue
+		}
+		var ce *CheckError
+		if !errors.As(err, &ce) {
+			t.Errorf("%s: Check() returned %v, want a *CheckError", test.name, err)
+			continue
+		}
+		if len(ce.Problems) != 1 || !strings.Contains(ce.Problems[0], test.want) {
+			t.Errorf("%s: Check() found %q, want one problem containing %q", test.name, ce.Problems, test.want)
+		}
+	}
+}
+
+func TestSaveFailedCheck(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "example.com.zone")
+	save := func(rdata string) error {
+		z, err := New(filename)
+		if err != nil {
+			t.Fatalf("New() returned an error: %v", err)
+		}
+		z.Origin = "example.com."
+		z.Add(ResourceRecord{Name: "a.example.com.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{rdata}})
+		_, err = z.Save()
+		return err
+	}
+
+	if err := save("10.0.0.1"); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+	if err := save("10.0.0.256"); err == nil {
+		t.Errorf("Save() of an invalid zone didn't return an error")
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Unable to read zone file: %v", err)
+	}
+	if want := "a.example.com. 300 IN A 10.0.0.1\n"; string(b) != want {
+		t.Errorf("zone file was changed by a failed Save(): got %q, want %q", string(b), want)
+	}
+}
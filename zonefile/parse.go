@@ -0,0 +1,320 @@
+package zonefile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Load reads the zone file `filename` and returns its records.  See
+// Parse for details.
+func Load(filename, origin string) ([]ResourceRecord, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rrs, err := Parse(f, origin)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return rrs, nil
+}
+
+// Parse reads records from a BIND-style zone file.  It understands
+// the files written by Save as well as typical hand-written zones:
+// comments, `$ORIGIN` and `$TTL` directives, names relative to the
+// origin, blank owner names, optional TTLs and classes, quoted
+// strings, and records split across lines with parentheses.
+// `$INCLUDE` isn't supported.
+//
+// Owner names, and domain names inside the rdata of common record
+// types, are returned fully-qualified.  `origin` is the initial
+// origin, with a trailing dot; it may be empty if the file only uses
+// absolute names.
+func Parse(r io.Reader, origin string) ([]ResourceRecord, error) {
+	return parse(r, origin, 0)
+}
+
+// parse is Parse, but stops after `limit` records if limit is
+// positive.
+func parse(r io.Reader, origin string, limit int) ([]ResourceRecord, error) {
+	p := &parser{origin: origin}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var tokens []string
+	startLine := 0
+	blankOwner := false
+	depth := 0
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+
+		lineTokens, opens, err := tokenize(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		if depth == 0 {
+			if len(lineTokens) == 0 {
+				continue
+			}
+			startLine = lineNum
+			blankOwner = line[0] == ' ' || line[0] == '\t'
+		}
+		tokens = append(tokens, lineTokens...)
+		depth += opens
+		if depth < 0 {
+			return nil, fmt.Errorf("line %d: unbalanced ')'", lineNum)
+		}
+		if depth > 0 {
+			continue
+		}
+
+		err = p.entry(tokens, blankOwner)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", startLine, err)
+		}
+		tokens = nil
+		if limit > 0 && len(p.records) >= limit {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("line %d: unbalanced '('", startLine)
+	}
+
+	return p.records, nil
+}
+
+type parser struct {
+	origin   string
+	ttl      uint32
+	hasTTL   bool
+	lastName string
+	lastTTL  uint32
+	records  []ResourceRecord
+}
+
+// tokenize splits a single line into tokens, dropping comments.
+// Quoted strings are returned with their quotes.  It also returns the
+// net number of parentheses opened on this line; the parentheses
+// themselves aren't returned.
+func tokenize(line string) ([]string, int, error) {
+	var tokens []string
+	opens := 0
+	i := 0
+
+	for i < len(line) {
+		c := line[i]
+		switch {
+		case c == ';':
+			return tokens, opens, nil
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '(':
+			opens++
+			i++
+		case c == ')':
+			opens--
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(line) && line[j] != '"' {
+				if line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(line) {
+				return nil, 0, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, line[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(line) && !strings.ContainsRune(" \t\r;()\"", rune(line[j])) {
+				if line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j > len(line) {
+				j = len(line)
+			}
+			tokens = append(tokens, line[i:j])
+			i = j
+		}
+	}
+	return tokens, opens, nil
+}
+
+// entry handles a single directive or record.
+func (p *parser) entry(tokens []string, blankOwner bool) error {
+	switch strings.ToUpper(tokens[0]) {
+	case "$ORIGIN":
+		if len(tokens) != 2 {
+			return fmt.Errorf("$ORIGIN needs exactly one name")
+		}
+		p.origin = p.absolute(tokens[1])
+		return nil
+	case "$TTL":
+		if len(tokens) != 2 {
+			return fmt.Errorf("$TTL needs exactly one value")
+		}
+		ttl, err := ParseTTL(tokens[1])
+		if err != nil {
+			return err
+		}
+		p.ttl = ttl
+		p.hasTTL = true
+		return nil
+	case "$INCLUDE":
+		return fmt.Errorf("$INCLUDE is not supported")
+	}
+
+	rr := ResourceRecord{Class: "IN"}
+	if blankOwner {
+		if p.lastName == "" {
+			return fmt.Errorf("record without an owner name")
+		}
+		rr.Name = p.lastName
+	} else {
+		rr.Name = p.absolute(tokens[0])
+		tokens = tokens[1:]
+	}
+
+	// The TTL and class are both optional, and may appear in
+	// either order.
+	hasTTL := false
+	for len(tokens) > 0 {
+		if ttl, err := ParseTTL(tokens[0]); err == nil && !hasTTL {
+			rr.TTL = ttl
+			hasTTL = true
+			tokens = tokens[1:]
+			continue
+		}
+		if class := strings.ToUpper(tokens[0]); class == "IN" || class == "CH" || class == "HS" {
+			rr.Class = class
+			tokens = tokens[1:]
+			continue
+		}
+		break
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("record for %q has no type", rr.Name)
+	}
+	rr.Type = strings.ToUpper(tokens[0])
+	if len(tokens) < 2 {
+		return fmt.Errorf("%s record for %q has no data", rr.Type, rr.Name)
+	}
+
+	if !hasTTL {
+		switch {
+		case p.hasTTL:
+			rr.TTL = p.ttl
+		case blankOwner:
+			rr.TTL = p.lastTTL
+		}
+	}
+
+	rdata := p.absoluteRdata(rr.Type, tokens[1:])
+	rr.Rdata = []string{strings.Join(rdata, " ")}
+
+	p.lastName = rr.Name
+	p.lastTTL = rr.TTL
+	p.records = append(p.records, rr)
+	return nil
+}
+
+// absolute makes name fully-qualified.
+func (p *parser) absolute(name string) string {
+	switch {
+	case name == "@":
+		return p.origin
+	case strings.HasSuffix(name, "."):
+		return name
+	case p.origin == "":
+		return name + "."
+	default:
+		return name + "." + p.origin
+	}
+}
+
+// nameFields lists the rdata fields that are domain names for common
+// record types.
+var nameFields = map[string][]int{
+	"CNAME": {0},
+	"DNAME": {0},
+	"NS":    {0},
+	"PTR":   {0},
+	"MX":    {1},
+	"SRV":   {3},
+	"SOA":   {0, 1},
+}
+
+// absoluteRdata makes the domain names in rdata fully-qualified.
+func (p *parser) absoluteRdata(rtype string, rdata []string) []string {
+	for _, i := range nameFields[rtype] {
+		if i < len(rdata) {
+			rdata[i] = p.absolute(rdata[i])
+		}
+	}
+	return rdata
+}
+
+// ParseTTL parses a TTL in seconds, optionally using BIND's unit
+// suffixes, like `1h30m` or `2d`.
+func ParseTTL(s string) (uint32, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty TTL")
+	}
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(n), nil
+	}
+
+	var total uint64
+	num := ""
+	for _, c := range strings.ToLower(s) {
+		if c >= '0' && c <= '9' {
+			num += string(c)
+			continue
+		}
+		if num == "" {
+			return 0, fmt.Errorf("invalid TTL %q", s)
+		}
+		n, _ := strconv.ParseUint(num, 10, 32)
+		switch c {
+		case 's':
+		case 'm':
+			n *= 60
+		case 'h':
+			n *= 3600
+		case 'd':
+			n *= 86400
+		case 'w':
+			n *= 604800
+		default:
+			return 0, fmt.Errorf("invalid TTL %q", s)
+		}
+		total += n
+		num = ""
+	}
+	if num != "" {
+		return 0, fmt.Errorf("invalid TTL %q", s)
+	}
+	if total > 0xffffffff {
+		return 0, fmt.Errorf("TTL %q is too large", s)
+	}
+	return uint32(total), nil
+}
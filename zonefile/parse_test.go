@@ -0,0 +1,93 @@
+package zonefile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	zone := `; Hand-written zone
+$TTL 1h
+@	IN	SOA	ns1 hostmaster.example.com. (
+		2024050201 ; serial
+		3600 600 1209600 300 )
+	IN	NS	ns1
+ns1		A	192.0.2.53
+www 300 IN A 192.0.2.1
+	IN	AAAA	2001:db8::1
+mail	IN 1d	MX	10 mx1.example.net.
+txt		TXT	"v=spf1 -all ; not a comment"
+$ORIGIN sub.example.com.
+host		CNAME	www.example.com.
+a.example.com. 300 IN A 192.0.2.2
+`
+
+	got, err := Parse(strings.NewReader(zone), "example.com.")
+	if err != nil {
+		t.Fatalf("Parse() returned an error: %v", err)
+	}
+
+	want := []ResourceRecord{
+		{Name: "example.com.", Type: "SOA", Class: "IN", TTL: 3600, Rdata: []string{"ns1.example.com. hostmaster.example.com. 2024050201 3600 600 1209600 300"}},
+		{Name: "example.com.", Type: "NS", Class: "IN", TTL: 3600, Rdata: []string{"ns1.example.com."}},
+		{Name: "ns1.example.com.", Type: "A", Class: "IN", TTL: 3600, Rdata: []string{"192.0.2.53"}},
+		{Name: "www.example.com.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{"192.0.2.1"}},
+		{Name: "www.example.com.", Type: "AAAA", Class: "IN", TTL: 3600, Rdata: []string{"2001:db8::1"}},
+		{Name: "mail.example.com.", Type: "MX", Class: "IN", TTL: 86400, Rdata: []string{"10 mx1.example.net."}},
+		{Name: "txt.example.com.", Type: "TXT", Class: "IN", TTL: 3600, Rdata: []string{`"v=spf1 -all ; not a comment"`}},
+		{Name: "host.sub.example.com.", Type: "CNAME", Class: "IN", TTL: 3600, Rdata: []string{"www.example.com."}},
+		{Name: "a.example.com.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{"192.0.2.2"}},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Parse() returned %d records, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("record %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"www 300 IN A\n",
+		"@ IN SOA ns1 hostmaster ( 1 2 3 4 5\n",
+		"txt IN TXT \"unterminated\n",
+		"$INCLUDE other.zone\n",
+		"  IN A 192.0.2.1\n",
+	}
+
+	for _, test := range tests {
+		_, err := Parse(strings.NewReader(test), "example.com.")
+		if err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", test)
+		}
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint32
+	}{
+		{"300", 300},
+		{"1h", 3600},
+		{"1h30m", 5400},
+		{"2D", 172800},
+		{"1w", 604800},
+	}
+	for _, test := range tests {
+		got, err := ParseTTL(test.in)
+		if err != nil || got != test.want {
+			t.Errorf("ParseTTL(%q): got %d, %v; want %d", test.in, got, err, test.want)
+		}
+	}
+
+	for _, bad := range []string{"", "h", "1x", "10m5"} {
+		if _, err := ParseTTL(bad); err == nil {
+			t.Errorf("ParseTTL(%q) succeeded, want error", bad)
+		}
+	}
+}
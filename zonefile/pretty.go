@@ -0,0 +1,285 @@
+package zonefile
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Output formats for zone files.
+const (
+	// FormatPlain writes one fully-qualified record per line, with
+	// no directives or comments.
+	FormatPlain = "plain"
+
+	// FormatPretty writes a header comment, `$ORIGIN` and `$TTL`
+	// directives, and records in canonical order with names
+	// relative to the origin and aligned columns.
+	FormatPretty = "pretty"
+)
+
+// typeOrder gives the order of record types for each owner name in
+// pretty zone files.  Types are ordered by their type code, so SOA
+// comes after NS, but the SOA is always written first anyway.
+// Unknown types sort after these, by name.
+var typeOrder = map[string]int{
+	"A":     1,
+	"NS":    2,
+	"CNAME": 5,
+	"SOA":   6,
+	"PTR":   12,
+	"MX":    15,
+	"TXT":   16,
+	"AAAA":  28,
+	"SRV":   33,
+	"CAA":   257,
+}
+
+// line is a single record in a pretty zone file.
+type line struct {
+	name    string
+	ttl     uint32
+	class   string
+	rtype   string
+	rdata   string
+	comment string
+}
+
+// renderPretty writes the zone to w in FormatPretty.
+func (z *Zone) renderPretty(w io.Writer, serial uint32, now time.Time) error {
+	origin := z.Origin
+	if origin == "" && z.SOA != nil {
+		origin = z.SOA.Name
+	}
+
+	// Sorting needs every record at once, but lines only refer to
+	// the zone's existing strings.
+	n := 1
+	for _, rr := range z.ResourceRecords {
+		n += len(rr.Rdata)
+	}
+	lines := make([]line, 0, n)
+	if z.SOA != nil {
+		lines = append(lines, line{z.SOA.Name, z.SOA.TTL, "IN", "SOA", z.SOA.rdata(serial), ""})
+	}
+	soaLines := len(lines)
+	for _, rr := range z.ResourceRecords {
+		comment := ""
+		if z.Comments {
+			comment = rr.Comment
+		}
+		for _, rd := range rr.Rdata {
+			lines = append(lines, line{rr.Name, rr.TTL, rr.Class, rr.Type, rd, comment})
+		}
+	}
+	records := lines[soaLines:]
+	sortLines(records)
+
+	var nameWidth, ttlWidth, typeWidth, rdataWidth int
+	for i := range lines {
+		l := &lines[i]
+		l.name = relativeName(l.name, origin)
+		nameWidth = max(nameWidth, len(l.name))
+		if l.ttl != z.DefaultTTL {
+			ttlWidth = max(ttlWidth, len(fmt.Sprint(l.ttl)))
+		}
+		typeWidth = max(typeWidth, len(l.rtype))
+		if l.comment != "" {
+			rdataWidth = max(rdataWidth, len(l.rdata))
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "; Generated %s\n", now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	for _, h := range z.Header {
+		_, err = fmt.Fprintf(w, "; %s\n", h)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "; %s\n\n", countRecords(records))
+	if err != nil {
+		return err
+	}
+
+	if origin != "" {
+		_, err = fmt.Fprintf(w, "$ORIGIN %s\n", origin)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "$TTL %d\n\n", z.DefaultTTL)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range lines {
+		ttl := ""
+		if l.ttl != z.DefaultTTL {
+			ttl = fmt.Sprint(l.ttl)
+		}
+		if ttlWidth > 0 {
+			_, err = fmt.Fprintf(w, "%-*s %-*s %s %-*s ", nameWidth, l.name, ttlWidth, ttl, l.class, typeWidth, l.rtype)
+		} else {
+			_, err = fmt.Fprintf(w, "%-*s %s %-*s ", nameWidth, l.name, l.class, typeWidth, l.rtype)
+		}
+		if err != nil {
+			return err
+		}
+		if l.comment != "" {
+			// Comments are lined up after the longest
+			// rdata that has one.
+			_, err = fmt.Fprintf(w, "%-*s ; %s\n", rdataWidth, l.rdata, l.comment)
+		} else {
+			_, err = fmt.Fprintf(w, "%s\n", l.rdata)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countRecords summarizes the number of records of each type, like
+// "5 records: 3 A, 2 AAAA".
+func countRecords(lines []line) string {
+	counts := map[string]int{}
+	var types []string
+	for _, l := range lines {
+		if counts[l.rtype] == 0 {
+			types = append(types, l.rtype)
+		}
+		counts[l.rtype]++
+	}
+	sort.Slice(types, func(i, j int) bool { return compareTypes(types[i], types[j]) < 0 })
+
+	parts := make([]string, len(types))
+	for i, t := range types {
+		parts[i] = fmt.Sprintf("%d %s", counts[t], t)
+	}
+	str := fmt.Sprintf("%d records", len(lines))
+	if len(parts) > 0 {
+		str += ": " + strings.Join(parts, ", ")
+	}
+	return str
+}
+
+// relativeName returns name relative to origin: "@" for the origin
+// itself, and names outside of the origin unchanged.
+func relativeName(name, origin string) string {
+	if origin == "" {
+		return name
+	}
+	if strings.EqualFold(name, origin) {
+		return "@"
+	}
+	i := len(name) - len(origin) - 1
+	if i > 0 && name[i] == '.' && strings.EqualFold(name[i+1:], origin) {
+		return name[:i]
+	}
+	return name
+}
+
+// sortLines sorts records into canonical DNS order (RFC 4034, section
+// 6.1) by owner name, then by type, and then by rdata.  Addresses
+// are compared numerically, so 10.0.0.2 comes before 10.0.0.10.
+func sortLines(lines []line) {
+	sort.SliceStable(lines, func(i, j int) bool {
+		a, b := lines[i], lines[j]
+		if c := CompareNames(a.name, b.name); c != 0 {
+			return c < 0
+		}
+		if c := compareTypes(a.rtype, b.rtype); c != 0 {
+			return c < 0
+		}
+		return compareRdata(a.rtype, a.rdata, b.rdata) < 0
+	})
+}
+
+// CompareNames compares two domain names in canonical order: label
+// by label starting from the root, ignoring case, so that each name
+// sorts immediately before the names below it.  It returns a negative
+// number if a sorts first, a positive number if b does, and 0 if
+// they're the same name.  It's called for every comparison while
+// sorting, so it doesn't allocate.
+func CompareNames(a, b string) int {
+	a = strings.TrimSuffix(a, ".")
+	b = strings.TrimSuffix(b, ".")
+	for a != "" && b != "" {
+		var la, lb string
+		a, la = lastLabel(a)
+		b, lb = lastLabel(b)
+		if c := compareFold(la, lb); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+// lastLabel splits the last label off of name.
+func lastLabel(name string) (string, string) {
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 {
+		return "", name
+	}
+	return name[:i], name[i+1:]
+}
+
+// compareFold compares two ASCII strings, ignoring case.
+func compareFold(a, b string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		ca, cb := lower(a[i]), lower(b[i])
+		if ca != cb {
+			return int(ca) - int(cb)
+		}
+	}
+	return len(a) - len(b)
+}
+
+func lower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// compareTypes compares two record types using typeOrder.
+func compareTypes(a, b string) int {
+	oa, ok := typeOrder[a]
+	if !ok {
+		oa = 1 << 16
+	}
+	ob, ok := typeOrder[b]
+	if !ok {
+		ob = 1 << 16
+	}
+	if oa != ob {
+		return oa - ob
+	}
+	return strings.Compare(a, b)
+}
+
+// compareRdata compares the rdata of two records of type rtype,
+// numerically for addresses.
+func compareRdata(rtype, a, b string) int {
+	if rtype == "A" || rtype == "AAAA" {
+		aa, errA := netip.ParseAddr(a)
+		ab, errB := netip.ParseAddr(b)
+		if errA == nil && errB == nil {
+			return aa.Compare(ab)
+		}
+	}
+	return strings.Compare(a, b)
+}
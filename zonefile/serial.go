@@ -0,0 +1,87 @@
+package zonefile
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Strategies for choosing SOA serials.  Whatever the strategy, a new
+// serial is only chosen when the zone's contents change, and it's
+// always greater than the previous serial in RFC 1982 serial number
+// arithmetic, so secondaries will see the change.
+const (
+	// SerialUnixTime uses the current time in seconds since 1970.
+	SerialUnixTime = "unixtime"
+
+	// SerialDate uses YYYYMMDDnn, where nn counts changes made on
+	// the same day.
+	SerialDate = "date"
+
+	// SerialIncrement adds one to the previous serial.
+	SerialIncrement = "increment"
+)
+
+// NextSerial returns the serial to use for a zone that has changed.
+// `prev` is the zone's previous serial; `hasPrev` is false for new
+// zones.  If the strategy's preferred serial isn't greater than prev,
+// for example after more than 100 changes in a day with SerialDate,
+// or after switching strategies, prev+1 is used instead.  Serials
+// wrap around from 4294967295 to 0, as RFC 1982 allows.
+func NextSerial(strategy string, prev uint32, hasPrev bool, now time.Time) (uint32, error) {
+	var serial uint32
+	switch strategy {
+	case SerialUnixTime, "":
+		serial = uint32(now.Unix())
+	case SerialDate:
+		y, m, d := now.UTC().Date()
+		serial = uint32(y*1000000 + int(m)*10000 + d*100) // Fits in 32 bits until the year 4294
+	case SerialIncrement:
+		serial = prev + 1
+		if !hasPrev {
+			serial = 1
+		}
+	default:
+		return 0, fmt.Errorf("Unknown serial strategy %q", strategy)
+	}
+
+	if hasPrev && !SerialGreater(serial, prev) {
+		serial = prev + 1
+	}
+	return serial, nil
+}
+
+// SerialGreater returns true if serial a is greater than serial b,
+// using the serial number arithmetic from RFC 1982.  Comparisons
+// between serials exactly 2^31 apart are undefined, and return false.
+func SerialGreater(a, b uint32) bool {
+	return a != b && a-b < 1<<31
+}
+
+// previousSerial returns the SOA serial from the zone's existing
+// file.  Save always writes the SOA first, so only the first record
+// is read.  It returns false if the file is missing, can't be parsed,
+// or doesn't start with an SOA record.
+func (z *Zone) previousSerial() (uint32, bool) {
+	f, err := os.Open(z.Filename)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	rrs, err := parse(f, z.SOA.Name, 1)
+	if err != nil || len(rrs) == 0 || rrs[0].Type != "SOA" {
+		return 0, false
+	}
+	fields := strings.Fields(rrs[0].Rdata[0])
+	if len(fields) < 3 {
+		return 0, false
+	}
+	serial, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(serial), true
+}
@@ -0,0 +1,75 @@
+package zonefile
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextSerial(t *testing.T) {
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	unix := uint32(now.Unix())
+
+	tests := []struct {
+		strategy string
+		prev     uint32
+		hasPrev  bool
+		want     uint32
+	}{
+		{SerialUnixTime, 0, false, unix},
+		{SerialUnixTime, unix - 100, true, unix},
+		{SerialUnixTime, unix, true, unix + 1},
+		{"", 0, false, unix},
+		{SerialDate, 0, false, 2024050200},
+		{SerialDate, 2024050107, true, 2024050200},
+		{SerialDate, 2024050200, true, 2024050201},
+		{SerialDate, 2024050299, true, 2024050300},
+		{SerialDate, 2024060100, true, 2024060101},
+		{SerialIncrement, 0, false, 1},
+		{SerialIncrement, 0, true, 1},
+		{SerialIncrement, 41, true, 42},
+		{SerialIncrement, 4294967295, true, 0},
+		// Switching from unixtime to date gives a larger serial.
+		{SerialDate, unix, true, 2024050200},
+		// Switching back doesn't, so the serial is incremented.
+		{SerialUnixTime, 2024050200, true, 2024050201},
+	}
+
+	for _, test := range tests {
+		got, err := NextSerial(test.strategy, test.prev, test.hasPrev, now)
+		if err != nil {
+			t.Errorf("NextSerial(%q, %d, %v) returned an error: %v", test.strategy, test.prev, test.hasPrev, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("NextSerial(%q, %d, %v): got %d, want %d", test.strategy, test.prev, test.hasPrev, got, test.want)
+		}
+		if test.hasPrev && !SerialGreater(got, test.prev) {
+			t.Errorf("NextSerial(%q, %d, %v): %d isn't greater than the previous serial", test.strategy, test.prev, test.hasPrev, got)
+		}
+	}
+
+	if _, err := NextSerial("random", 0, false, now); err == nil {
+		t.Errorf("NextSerial(\"random\") succeeded, want error")
+	}
+}
+
+func TestSerialGreater(t *testing.T) {
+	tests := []struct {
+		a, b uint32
+		want bool
+	}{
+		{2, 1, true},
+		{1, 2, false},
+		{1, 1, false},
+		{0, 4294967295, true},
+		{4294967295, 0, false},
+		{1 << 31, 0, false},
+		{1<<31 - 1, 0, true},
+		{5, 4294967000, true},
+	}
+	for _, test := range tests {
+		if got := SerialGreater(test.a, test.b); got != test.want {
+			t.Errorf("SerialGreater(%d, %d): got %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
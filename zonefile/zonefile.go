@@ -3,13 +3,70 @@ package zonefile
 // "github.com/shuLhan/share/lib/dns" をベースに netbox2dns に必要なもののみに絞る
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 )
 
 type Zone struct {
-	File            *os.File
+	Filename        string
 	ResourceRecords []ResourceRecord
+
+	// SOA, if set, is written at the top of the file, making it
+	// a complete zone rather than a fragment for `$INCLUDE`.
+	SOA *SOA
+
+	// Format is FormatPlain (the default) or FormatPretty.
+	Format string
+
+	// Origin and DefaultTTL are used for the `$ORIGIN` and `$TTL`
+	// directives in FormatPretty.  Origin has a trailing dot; if
+	// it's empty, the SOA's name is used.
+	Origin     string
+	DefaultTTL uint32
+
+	// Header holds extra lines for the comment at the top of
+	// FormatPretty files.  The comment isn't considered when
+	// deciding whether the zone has changed.
+	Header []string
+
+	// Comments adds each record's Comment to the end of its line.
+	Comments bool
+
+	// Backup, if set, is where Save keeps copies of the file's
+	// previous versions.
+	Backup *Backup
+}
+
+// SOA describes a zone's SOA record.  The serial isn't set here; Save
+// keeps the serial from the existing file if nothing else in the
+// zone changed, and picks a new one with NextSerial otherwise.
+type SOA struct {
+	Name    string // The zone's origin, with a trailing dot
+	TTL     uint32
+	MName   string
+	RName   string
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minimum uint32
+
+	// SerialStrategy is how new serials are chosen; one of
+	// SerialUnixTime (the default), SerialDate, or
+	// SerialIncrement.
+	SerialStrategy string
+}
+
+// rdata returns the SOA's rdata with the given serial.
+func (s *SOA) rdata(serial uint32) string {
+	return fmt.Sprintf("%s %s %d %d %d %d %d", s.MName, s.RName, serial, s.Refresh, s.Retry, s.Expire, s.Minimum)
 }
 
 type ResourceRecord struct {
@@ -18,14 +75,19 @@ type ResourceRecord struct {
 	Class string
 	TTL   uint32
 	Rdata []string
+
+	// Comment is written after each of the record's lines if the
+	// zone has Comments set.  It's not returned by Parse.
+	Comment string
 }
 
+// New creates an empty Zone that will be saved to filename.  The
+// file isn't touched until Save is called.
 func New(filename string) (*Zone, error) {
-	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		return nil, err
+	if filename == "" {
+		return nil, fmt.Errorf("No filename specified")
 	}
-	return &Zone{File: f, ResourceRecords: []ResourceRecord{}}, nil
+	return &Zone{Filename: filename, ResourceRecords: []ResourceRecord{}}, nil
 }
 
 func (z *Zone) Add(r ResourceRecord) error {
@@ -33,17 +95,356 @@ func (z *Zone) Add(r ResourceRecord) error {
 	return nil
 }
 
-func (z *Zone) Save() error {
-	str := ""
+// Changes summarizes how SaveChanges changed a zone's file.  The SOA
+// record isn't counted, since its serial changes whenever anything
+// else does.
+type Changes struct {
+	Changed bool // True if the file's contents changed
+	Added   int  // Records in the new file that weren't in the old one
+	Removed int  // Records in the old file that aren't in the new one
+
+	Serial uint32 // The SOA serial in the new file, for zones with an SOA
+}
+
+// Save writes the zone to its file, as SaveChanges does, and returns
+// true if the file was changed.
+func (z *Zone) Save() (bool, error) {
+	changes, err := z.SaveChanges()
+	return changes.Changed, err
+}
+
+// SaveChanges writes the zone to its file, replacing the existing
+// file atomically.  If the file already has exactly the same
+// contents, ignoring any comments at the top, it isn't rewritten.
+// Otherwise, the zone must pass Check first, and the existing file is
+// left alone if it doesn't.
+//
+// Records are rendered straight into a buffered writer, first to
+// compare them with the existing file and then, if anything changed,
+// to a temporary file, so the rendered output is never held in memory
+// as a whole.  Memory use still grows with the size of the zone,
+// though: every record is in z.ResourceRecords, FormatPretty sorts an
+// index of all of them, and once the file is known to be different,
+// countChanges parses the old file into memory to count changes.
+func (z *Zone) SaveChanges() (Changes, error) {
+	var serial uint32
+	hasSerial := false
+	if z.SOA != nil {
+		serial, hasSerial = z.previousSerial()
+	}
+
+	now := time.Now()
+	same, err := z.sameAsFile(serial, now)
+	if err != nil || same {
+		return Changes{}, err
+	}
+	err = z.Check()
+	if err != nil {
+		return Changes{}, err
+	}
+
+	if z.SOA != nil {
+		serial, err = NextSerial(z.SOA.SerialStrategy, serial, hasSerial, now)
+		if err != nil {
+			return Changes{}, err
+		}
+	}
+	changes := z.countChanges()
+	if z.Backup != nil {
+		err = z.Backup.save(z.Filename)
+		if err != nil {
+			return Changes{}, err
+		}
+	}
+	err = WriteFileAtomic(z.Filename, func(w io.Writer) error {
+		return z.render(w, serial, now)
+	})
+	if err != nil {
+		return Changes{}, err
+	}
+	changes.Changed = true
+	changes.Serial = serial
+	return changes, nil
+}
+
+// countChanges compares the zone's records with the ones in its
+// existing file.  A record whose TTL changed counts as one removed
+// and one added.  If the old file is missing or can't be parsed,
+// every record counts as added.
+func (z *Zone) countChanges() Changes {
+	key := func(name string, ttl uint32, rtype, rdata string) string {
+		return fmt.Sprintf("%s %d %s %s", strings.ToLower(name), ttl, rtype, rdata)
+	}
+
+	old := map[string]int{}
+	if f, err := os.Open(z.Filename); err == nil {
+		origin := z.Origin
+		if origin == "" && z.SOA != nil {
+			origin = z.SOA.Name
+		}
+		rrs, err := Parse(f, origin)
+		f.Close()
+		if err == nil {
+			for _, rr := range rrs {
+				if rr.Type == "SOA" {
+					continue
+				}
+				for _, rd := range rr.Rdata {
+					old[key(rr.Name, rr.TTL, rr.Type, rd)]++
+				}
+			}
+		}
+	}
+
+	var changes Changes
 	for _, rr := range z.ResourceRecords {
 		for _, rd := range rr.Rdata {
-			str += fmt.Sprintf("%s %d %s %s %s\n", rr.Name, rr.TTL, rr.Class, rr.Type, rd)
+			k := key(rr.Name, rr.TTL, rr.Type, rd)
+			if old[k] > 0 {
+				old[k]--
+			} else {
+				changes.Added++
+			}
 		}
 	}
+	for _, n := range old {
+		changes.Removed += n
+	}
+	return changes
+}
+
+// render writes the zone file's contents to w, using serial for the
+// SOA record if there is one.  `now` is the generation time shown in
+// FormatPretty's header.
+func (z *Zone) render(w io.Writer, serial uint32, now time.Time) error {
+	switch z.Format {
+	case "", FormatPlain:
+	case FormatPretty:
+		return z.renderPretty(w, serial, now)
+	default:
+		return fmt.Errorf("Unknown zone file format %q", z.Format)
+	}
 
-	_, err := z.File.WriteString(str)
+	if z.SOA != nil {
+		_, err := fmt.Fprintf(w, "%s %d IN SOA %s\n", z.SOA.Name, z.SOA.TTL, z.SOA.rdata(serial))
+		if err != nil {
+			return err
+		}
+	}
+	for _, rr := range z.ResourceRecords {
+		comment := ""
+		if z.Comments && rr.Comment != "" {
+			comment = " ; " + rr.Comment
+		}
+		for _, rd := range rr.Rdata {
+			_, err := fmt.Fprintf(w, "%s %d %s %s %s%s\n", rr.Name, rr.TTL, rr.Class, rr.Type, rd, comment)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sameAsFile returns true if rendering the zone with serial would
+// produce the contents of the existing file, ignoring comments at the
+// top of each.  The output is compared as it's rendered, and
+// rendering stops at the first difference.
+func (z *Zone) sameAsFile(serial uint32, now time.Time) (bool, error) {
+	f, err := os.Open(z.Filename)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
 	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	old := bufio.NewReader(f)
+	err = skipHeader(old)
+	if err != nil {
+		return false, err
+	}
+
+	cw := &compareWriter{r: old}
+	w := bufio.NewWriter(&headerSkipper{w: cw})
+	err = z.render(w, serial, now)
+	if err == nil {
+		err = w.Flush()
+	}
+	if errors.Is(err, errDiffers) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// The old file may still have more records.
+	_, err = old.ReadByte()
+	if err == io.EOF {
+		return true, nil
+	}
+	return false, err
+}
+
+// errDiffers is returned by compareWriter when the data written to
+// it doesn't match its reader.
+var errDiffers = errors.New("contents differ")
+
+// compareWriter is an io.Writer that compares everything written to
+// it with the next bytes from r, returning errDiffers on the first
+// mismatch.
+type compareWriter struct {
+	r   io.Reader
+	buf [4096]byte
+}
+
+func (c *compareWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		chunk := min(len(p), len(c.buf))
+		_, err := io.ReadFull(c.r, c.buf[:chunk])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, errDiffers
+		}
+		if err != nil {
+			return 0, err
+		}
+		if !bytes.Equal(c.buf[:chunk], p[:chunk]) {
+			return 0, errDiffers
+		}
+		p = p[chunk:]
+	}
+	return n, nil
+}
+
+// headerSkipper is an io.Writer that drops any comment lines at the
+// start of its input, and passes everything after them on to w.
+type headerSkipper struct {
+	w         io.Writer
+	inComment bool
+	done      bool
+}
+
+func (h *headerSkipper) Write(p []byte) (int, error) {
+	n := len(p)
+	for !h.done && len(p) > 0 {
+		switch {
+		case h.inComment:
+			i := bytes.IndexByte(p, '\n')
+			if i < 0 {
+				return n, nil
+			}
+			p = p[i+1:]
+			h.inComment = false
+		case p[0] == ';':
+			h.inComment = true
+		default:
+			h.done = true
+		}
+	}
+	if len(p) > 0 {
+		if _, err := h.w.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// skipHeader reads past any comment lines at the start of r.
+func skipHeader(r *bufio.Reader) error {
+	for {
+		b, err := r.Peek(1)
+		if err == io.EOF || (err == nil && b[0] != ';') {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for {
+			_, err = r.ReadSlice('\n')
+			if err != bufio.ErrBufferFull {
+				break
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// WriteFileAtomic calls write to write the file's contents to a
+// temporary file in the same directory as filename, and then renames
+// it into place, so readers never see a partially-written file.
+// Missing parent directories are created.  If filename is a symlink,
+// the file it points to is replaced instead, and an existing file
+// keeps its mode and owner; new files are created with mode 0644.
+func WriteFileAtomic(filename string, write func(io.Writer) error) error {
+	if target, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = target
+	}
+	fi, err := os.Lstat(filename)
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	return z.File.Close()
+
+	err = os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = setModeAndOwner(f, fi)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// setModeAndOwner gives f the mode and owner from fi, the file that f
+// is replacing, or mode 0644 if fi is nil.
+func setModeAndOwner(f *os.File, fi os.FileInfo) error {
+	if fi == nil {
+		return f.Chmod(0644)
+	}
+	err := f.Chmod(fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	tfi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if tst, ok := tfi.Sys().(*syscall.Stat_t); ok && tst.Uid == st.Uid && tst.Gid == st.Gid {
+		return nil
+	}
+	err = f.Chown(int(st.Uid), int(st.Gid))
+	if err != nil {
+		return fmt.Errorf("Unable to keep the owner of %s: %w", fi.Name(), err)
+	}
+	return nil
 }
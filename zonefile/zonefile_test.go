@@ -0,0 +1,467 @@
+package zonefile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveChanged(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "example.com.zone")
+
+	newZone := func(addr string) *Zone {
+		z, err := New(filename)
+		if err != nil {
+			t.Fatalf("New() returned an error: %v", err)
+		}
+		z.Add(ResourceRecord{Name: "a.example.com.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{addr}})
+		return z
+	}
+
+	changed, err := newZone("10.0.0.1").Save()
+	if err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+	if !changed {
+		t.Errorf("Save() of a new file: got changed=false, want true")
+	}
+
+	changed, err = newZone("10.0.0.1").Save()
+	if err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+	if changed {
+		t.Errorf("Save() with identical records: got changed=true, want false")
+	}
+
+	changed, err = newZone("10.0.0.2").Save()
+	if err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+	if !changed {
+		t.Errorf("Save() with new records: got changed=false, want true")
+	}
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Unable to read zone file: %v", err)
+	}
+	want := "a.example.com. 300 IN A 10.0.0.2\n"
+	if string(b) != want {
+		t.Errorf("zone file contents: got %q, want %q", string(b), want)
+	}
+
+	z, err := New(filename)
+	if err != nil {
+		t.Fatalf("New() returned an error: %v", err)
+	}
+	changed, err = z.Save()
+	if err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+	if !changed {
+		t.Errorf("Save() with fewer records: got changed=false, want true")
+	}
+	if b, _ := os.ReadFile(filename); len(b) != 0 {
+		t.Errorf("zone file contents: got %q, want an empty file", string(b))
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(filename))
+	if err != nil {
+		t.Fatalf("Unable to read directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want 1; temporary files were left behind", len(entries))
+	}
+}
+
+func TestSaveSOA(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "example.com.zone")
+
+	serial := func() uint32 {
+		rrs, err := Load(filename, "example.com.")
+		if err != nil {
+			t.Fatalf("Load() returned an error: %v", err)
+		}
+		if len(rrs) == 0 || rrs[0].Type != "SOA" {
+			t.Fatalf("zone file doesn't start with an SOA record: %+v", rrs)
+		}
+		s, err := strconv.ParseUint(strings.Fields(rrs[0].Rdata[0])[2], 10, 32)
+		if err != nil {
+			t.Fatalf("Unable to parse serial: %v", err)
+		}
+		return uint32(s)
+	}
+
+	save := func(addr string) bool {
+		z, err := New(filename)
+		if err != nil {
+			t.Fatalf("New() returned an error: %v", err)
+		}
+		z.SOA = &SOA{
+			Name: "example.com.", TTL: 300,
+			MName: "ns1.example.com.", RName: "hostmaster.example.com.",
+			Refresh: 3600, Retry: 600, Expire: 1209600, Minimum: 300,
+		}
+		z.Add(ResourceRecord{Name: "example.com.", Type: "NS", Class: "IN", TTL: 300, Rdata: []string{"ns1.example.com."}})
+		z.Add(ResourceRecord{Name: "a.example.com.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{addr}})
+		changed, err := z.Save()
+		if err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+		return changed
+	}
+
+	if !save("10.0.0.1") {
+		t.Errorf("Save() of a new file: got changed=false, want true")
+	}
+	first := serial()
+	if first == 0 {
+		t.Errorf("serial of a new zone is 0")
+	}
+
+	if save("10.0.0.1") {
+		t.Errorf("Save() with identical records: got changed=true, want false")
+	}
+	if got := serial(); got != first {
+		t.Errorf("serial changed without a change to the zone: got %d, want %d", got, first)
+	}
+
+	if !save("10.0.0.2") {
+		t.Errorf("Save() with new records: got changed=false, want true")
+	}
+	if got := serial(); got <= first {
+		t.Errorf("serial after a change: got %d, want more than %d", got, first)
+	}
+}
+
+func TestSaveCreatesDirectories(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "reverse", "v4", "10.in-addr.arpa.zone")
+
+	z, err := New(filename)
+	if err != nil {
+		t.Fatalf("New() returned an error: %v", err)
+	}
+	z.Add(ResourceRecord{Name: "1.0.0.10.in-addr.arpa.", Type: "PTR", Class: "IN", TTL: 300, Rdata: []string{"a.example.com."}})
+	if _, err := z.Save(); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+	if _, err := os.Stat(filename); err != nil {
+		t.Errorf("zone file wasn't written: %v", err)
+	}
+}
+
+func TestSavePretty(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "example.com.zone")
+
+	newZone := func() *Zone {
+		z, err := New(filename)
+		if err != nil {
+			t.Fatalf("New() returned an error: %v", err)
+		}
+		z.Format = FormatPretty
+		z.Origin = "example.com."
+		z.DefaultTTL = 300
+		z.Header = []string{"Written by a test"}
+		z.SOA = &SOA{
+			Name: "example.com.", TTL: 300,
+			MName: "ns1.example.com.", RName: "hostmaster.example.com.",
+			Refresh: 3600, Retry: 600, Expire: 1209600, Minimum: 300,
+			SerialStrategy: SerialIncrement,
+		}
+		z.Add(ResourceRecord{Name: "www.example.com.", Type: "AAAA", Class: "IN", TTL: 300, Rdata: []string{"2001:db8::1"}})
+		z.Add(ResourceRecord{Name: "b.www.example.com.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{"10.0.0.3"}})
+		z.Add(ResourceRecord{Name: "WWW.example.com.", Type: "A", Class: "IN", TTL: 60, Rdata: []string{"10.0.0.10", "10.0.0.2"}})
+		z.Add(ResourceRecord{Name: "example.com.", Type: "NS", Class: "IN", TTL: 300, Rdata: []string{"ns1.example.com."}})
+		return z
+	}
+	save := func() bool {
+		changed, err := newZone().Save()
+		if err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+		return changed
+	}
+
+	if !save() {
+		t.Errorf("Save() of a new file: got changed=false, want true")
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Unable to read zone file: %v", err)
+	}
+	if !strings.HasPrefix(string(b), "; Generated ") || !strings.Contains(string(b), "; Written by a test\n; 5 records: 3 A, 1 NS, 1 AAAA\n") {
+		t.Errorf("zone file header wrong:\n%s", b)
+	}
+	want := `
+$ORIGIN example.com.
+$TTL 300
+
+@        IN SOA  ns1.example.com. hostmaster.example.com. 1 3600 600 1209600 300
+@        IN NS   ns1.example.com.
+WWW   60 IN A    10.0.0.2
+WWW   60 IN A    10.0.0.10
+www      IN AAAA 2001:db8::1
+b.www    IN A    10.0.0.3
+`
+	if got := string(b[bytes.Index(b, []byte("\n$ORIGIN")):]); got != want {
+		t.Errorf("zone file contents:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	if save() {
+		t.Errorf("Save() with identical records: got changed=true, want false")
+	}
+
+	rrs, err := Load(filename, "")
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	if len(rrs) != 6 || rrs[4].Name != "www.example.com." || rrs[4].TTL != 300 || rrs[2].TTL != 60 {
+		t.Errorf("Load() of a pretty zone file returned %+v", rrs)
+	}
+
+	// Names outside of the origin are written in full.  Check
+	// doesn't allow them in a zone, so render the zone directly.
+	z := newZone()
+	z.Add(ResourceRecord{Name: "mail.example.net.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{"10.0.0.4"}})
+	var buf bytes.Buffer
+	if err := z.render(&buf, 1, time.Now()); err != nil {
+		t.Fatalf("render() returned an error: %v", err)
+	}
+	b = buf.Bytes()
+	if !strings.Contains(string(b), "; Written by a test\n; 6 records: 4 A, 1 NS, 1 AAAA\n") {
+		t.Errorf("zone file header with a name outside of the origin wrong:\n%s", b)
+	}
+	want = `
+$ORIGIN example.com.
+$TTL 300
+
+@                    IN SOA  ns1.example.com. hostmaster.example.com. 1 3600 600 1209600 300
+@                    IN NS   ns1.example.com.
+WWW               60 IN A    10.0.0.2
+WWW               60 IN A    10.0.0.10
+www                  IN AAAA 2001:db8::1
+b.www                IN A    10.0.0.3
+mail.example.net.    IN A    10.0.0.4
+`
+	if got := string(b[bytes.Index(b, []byte("\n$ORIGIN")):]); got != want {
+		t.Errorf("zone file contents with a name outside of the origin:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSavePrettyOutsideOrigin(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "example.com.zone")
+	z, err := New(filename)
+	if err != nil {
+		t.Fatalf("New() returned an error: %v", err)
+	}
+	z.Format = FormatPretty
+	z.Origin = "example.com."
+	z.Add(ResourceRecord{Name: "www.example.com.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{"10.0.0.1"}})
+	z.Add(ResourceRecord{Name: "mail.example.net.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{"10.0.0.4"}})
+
+	_, err = z.Save()
+	var checkErr *CheckError
+	if !errors.As(err, &checkErr) || !strings.Contains(err.Error(), `mail.example.net. A: owner name is outside of zone "example.com."`) {
+		t.Errorf("Save() with a name outside of the origin: got %v, want a CheckError", err)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("Save() that failed its check wrote %q", filename)
+	}
+}
+
+// benchZone returns a zone with n PTR records, like a large ip6.arpa
+// zone.
+func benchZone(tb testing.TB, filename string, n int) *Zone {
+	z, err := New(filename)
+	if err != nil {
+		tb.Fatalf("New() returned an error: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		z.Add(ResourceRecord{
+			Name:  fmt.Sprintf("%x.%x.%x.%x.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", i&0xf, (i>>4)&0xf, (i>>8)&0xf, (i>>12)&0xf),
+			Type:  "PTR",
+			Class: "IN",
+			TTL:   300,
+			Rdata: []string{fmt.Sprintf("host%d.example.com.", i)},
+		})
+	}
+	return z
+}
+
+// TestSaveLinear checks that the memory allocated by Save grows
+// linearly with the number of records, whether the zone is written
+// or found to be unchanged.
+// BenchmarkSave measures writing whole zones, and comparing zones
+// with an unchanged file.  Allocations per record should stay about
+// the same as zones get bigger.
+func BenchmarkSave(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		for _, format := range []string{FormatPlain, FormatPretty} {
+			for _, write := range []bool{true, false} {
+				op := "compare"
+				if write {
+					op = "write"
+				}
+				b.Run(fmt.Sprintf("%s/%s/%d", format, op, n), func(b *testing.B) {
+					filename := filepath.Join(b.TempDir(), "ip6.zone")
+					z := benchZone(b, filename, n)
+					z.Format = format
+					z.Origin = "0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."
+					z.DefaultTTL = 300
+					if _, err := z.Save(); err != nil {
+						b.Fatalf("Save() returned an error: %v", err)
+					}
+					b.ReportAllocs()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						// Removing the file makes every
+						// iteration write the whole zone.
+						if write {
+							os.Remove(filename)
+						}
+						changed, err := z.Save()
+						if err != nil {
+							b.Fatalf("Save() returned an error: %v", err)
+						}
+						if changed != write {
+							b.Fatalf("Save() returned changed=%v, want %v", changed, write)
+						}
+					}
+					b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*n), "ns/record")
+				})
+			}
+		}
+	}
+}
+
+func TestSaveComments(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: FormatPlain,
+			want: "a.example.com. 300 IN A 10.0.0.1 ; netbox ipam/ip-addresses/1\n" +
+				"a.example.com. 300 IN AAAA 2001:db8::1 ; netbox ipam/ip-addresses/2 vrf=prod\n" +
+				"www.example.com. 300 IN CNAME a.example.com.\n",
+		},
+		{
+			format: FormatPretty,
+			want: "a   IN A     10.0.0.1    ; netbox ipam/ip-addresses/1\n" +
+				"a   IN AAAA  2001:db8::1 ; netbox ipam/ip-addresses/2 vrf=prod\n" +
+				"www IN CNAME a.example.com.\n",
+		},
+	}
+
+	for _, test := range tests {
+		filename := filepath.Join(t.TempDir(), "example.com.zone")
+		z, err := New(filename)
+		if err != nil {
+			t.Fatalf("New() returned an error: %v", err)
+		}
+		z.Format = test.format
+		z.Origin = "example.com."
+		z.DefaultTTL = 300
+		z.Comments = true
+		z.Add(ResourceRecord{Name: "a.example.com.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{"10.0.0.1"}, Comment: "netbox ipam/ip-addresses/1"})
+		z.Add(ResourceRecord{Name: "a.example.com.", Type: "AAAA", Class: "IN", TTL: 300, Rdata: []string{"2001:db8::1"}, Comment: "netbox ipam/ip-addresses/2 vrf=prod"})
+		z.Add(ResourceRecord{Name: "www.example.com.", Type: "CNAME", Class: "IN", TTL: 300, Rdata: []string{"a.example.com."}})
+		if _, err := z.Save(); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatalf("Unable to read zone file: %v", err)
+		}
+		if !strings.HasSuffix(string(b), test.want) {
+			t.Errorf("%s zone file contents:\ngot:\n%s\nwant it to end with:\n%s", test.format, b, test.want)
+		}
+
+		rrs, err := Load(filename, "example.com.")
+		if err != nil {
+			t.Fatalf("Load() returned an error: %v", err)
+		}
+		if len(rrs) != 3 || rrs[0].Rdata[0] != "10.0.0.1" {
+			t.Errorf("Load() of a %s zone file with comments returned %+v", test.format, rrs)
+		}
+	}
+}
+
+func TestSaveChangesCounts(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "example.com.zone")
+
+	save := func(records ...ResourceRecord) Changes {
+		z, err := New(filename)
+		if err != nil {
+			t.Fatalf("New() returned an error: %v", err)
+		}
+		for _, rr := range records {
+			z.Add(rr)
+		}
+		changes, err := z.SaveChanges()
+		if err != nil {
+			t.Fatalf("SaveChanges() returned an error: %v", err)
+		}
+		return changes
+	}
+	a := ResourceRecord{Name: "a.example.com.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{"10.0.0.1"}}
+	b := ResourceRecord{Name: "b.example.com.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{"10.0.0.2", "10.0.0.3"}}
+	c := ResourceRecord{Name: "c.example.com.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{"10.0.0.4"}}
+
+	if got, want := save(a, b), (Changes{Changed: true, Added: 3}); got != want {
+		t.Errorf("SaveChanges() of a new file: got %+v, want %+v", got, want)
+	}
+	if got, want := save(a, b), (Changes{}); got != want {
+		t.Errorf("SaveChanges() with identical records: got %+v, want %+v", got, want)
+	}
+	if got, want := save(a, c), (Changes{Changed: true, Added: 1, Removed: 2}); got != want {
+		t.Errorf("SaveChanges() with new records: got %+v, want %+v", got, want)
+	}
+}
+
+func TestSaveKeepsMode(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "example.com.zone")
+	if err := os.WriteFile(filename, []byte("; old\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filename, 0640); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.zone")
+	if err := os.Symlink(filename, link); err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := New(link)
+	if err != nil {
+		t.Fatalf("New() returned an error: %v", err)
+	}
+	z.Add(ResourceRecord{Name: "a.example.com.", Type: "A", Class: "IN", TTL: 300, Rdata: []string{"10.0.0.1"}})
+	if _, err := z.Save(); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+
+	fi, err := os.Lstat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode() != 0640 {
+		t.Errorf("Save() changed the mode to %v, want %v", fi.Mode(), os.FileMode(0640))
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Save() replaced the symlink: %v, %v", fi, err)
+	}
+	b, _ := os.ReadFile(filename)
+	if !strings.Contains(string(b), "10.0.0.1") {
+		t.Errorf("Save() didn't write through the symlink, got %q", b)
+	}
+}
@@ -2,6 +2,7 @@ package netbox2dns
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/scottlaird/netbox2dns/zonefile"
 )
@@ -13,11 +14,37 @@ type ZoneFileDNS struct {
 }
 
 // NewZoneFileDNS creates a new ZoneFileDNS object.
-func NewZoneFileDNS(ctx context.Context, cz *ConfigZone) (*ZoneFileDNS, error) {
+func NewZoneFileDNS(ctx context.Context, cfg *Config, cz *ConfigZone) (*ZoneFileDNS, error) {
 	zone, err := zonefile.New(cz.Filename)
 	if err != nil {
 		return nil, err
 	}
+	zone.Format = cz.Format
+	zone.Origin = cz.Name + "."
+	zone.DefaultTTL = uint32(cz.TTL)
+	zone.Comments = cz.Provenance
+	zone.Backup = zoneBackup(cfg, cz)
+	zone.Header = []string{
+		fmt.Sprintf("Written by netbox2dns %s from NetBox at %s; don't edit by hand.", version(), cfg.Netbox.Host),
+	}
+
+	if cz.Mode == "full" {
+		if cz.SOA == nil {
+			return nil, fmt.Errorf("Zone %q is in full mode but has no SOA settings", cz.Name)
+		}
+		zone.SOA = &zonefile.SOA{
+			Name:    cz.Name + ".",
+			TTL:     uint32(cz.TTL),
+			MName:   absoluteName(cz.SOA.MName, cz.Name),
+			RName:   MailboxName(cz.SOA.RName, cz.Name),
+			Refresh: cz.SOA.Refresh,
+			Retry:   cz.SOA.Retry,
+			Expire:  cz.SOA.Expire,
+			Minimum: cz.SOA.Minimum,
+
+			SerialStrategy: cz.SOA.Serial,
+		}
+	}
 
 	zfd := &ZoneFileDNS{
 		zone: zone,
@@ -33,6 +60,8 @@ func (zfd *ZoneFileDNS) rrFromRecord(cz *ConfigZone, r *Record) zonefile.Resourc
 		Class: "IN",
 		TTL:   uint32(r.TTL),
 		Rdata: r.Rrdatas,
+
+		Comment: r.Provenance(),
 	}
 }
 
@@ -50,7 +79,9 @@ func (zfd *ZoneFileDNS) WriteRecord(cz *ConfigZone, r *Record) error {
 }
 
 // Save flushes the current zonefile to disk.  Without this, no
-// changes will be written out.
-func (zfd *ZoneFileDNS) Save(cz *ConfigZone) error {
-	return zfd.zone.Save()
+// changes will be written out.  It returns how the file's contents
+// changed.
+func (zfd *ZoneFileDNS) Save(cz *ConfigZone) (Changes, error) {
+	c, err := zfd.zone.SaveChanges()
+	return Changes{Changed: c.Changed, Added: c.Added, Removed: c.Removed, Serial: c.Serial}, err
 }
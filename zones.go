@@ -41,13 +41,83 @@ func NewZones() *Zones {
 // longest suffix match among all known zones and adds the new record
 // there.  If no zones match, then an error is returned.
 func (z *Zones) AddRecord(r *Record) error {
-	for _, zone := range z.sortedZones {
-		if strings.HasSuffix(r.Name, zone.Name+".") {
-			zone.AddRecord(r)
+	zone, name := z.ZoneForRecord(r)
+	if zone == nil {
+		return fmt.Errorf("Can't find zone matching record %q in %v", r.Name, z.sortedZones)
+	}
+	r.Name = name
+	zone.AddRecord(r)
+	return nil
+}
+
+// ZoneForRecord returns the zone that r belongs in, and the name that
+// r should have in that zone.  PTR records go in the reverse zone
+// with the longest prefix containing their address; in classless
+// zones, they're named as RFC 2317 describes.  PTR records for
+// addresses that a zone delegates to a classless zone that isn't
+// managed here don't belong in any zone.  Other records, and PTR
+// records without an address, are placed using ZoneFor.
+func (z *Zones) ZoneForRecord(r *Record) (*Zone, string) {
+	if r.Type == "PTR" && r.Addr.IsValid() {
+		var best *Zone
+		for _, zone := range z.sortedZones {
+			if zone.Prefix.IsValid() && zone.Prefix.Contains(r.Addr) {
+				if best == nil || zone.Prefix.Bits() > best.Prefix.Bits() {
+					best = zone
+				}
+			}
+		}
+		if best != nil && best.classless() {
+			return best, fmt.Sprintf("%d.%s.", r.Addr.As4()[3], best.Name)
+		}
+		if best != nil {
+			return best.delegated(r), r.Name
+		}
+		return nil, r.Name
+	}
+
+	zone := z.ZoneFor(r.Name)
+	return zone, r.Name
+}
+
+// delegated returns nil if r's address has been delegated from z to
+// a classless zone, or z if it hasn't.
+func (z *Zone) delegated(r *Record) *Zone {
+	for _, d := range z.delegations {
+		if d.Contains(r.Addr) {
 			return nil
 		}
 	}
-	return fmt.Errorf("Can't find zone matching record %q in %v", r.Name, z.sortedZones)
+	return z
+}
+
+// classless returns true if z is an RFC 2317 classless reverse zone.
+func (z *Zone) classless() bool {
+	return z.Prefix.Addr().Is4() && z.Prefix.Bits() > 24
+}
+
+// ZoneFor returns the zone that a record named `name` belongs in,
+// using the longest suffix match among all known zones.  The name
+// must be fully-qualified, with a trailing dot.  If no zones match,
+// then nil is returned.
+func (z *Zones) ZoneFor(name string) *Zone {
+	matches := z.MatchingZones(name)
+	if len(matches) == 0 {
+		return nil
+	}
+	return matches[0]
+}
+
+// MatchingZones returns every zone that `name` could belong in, from
+// the longest (most specific) to the shortest.
+func (z *Zones) MatchingZones(name string) []*Zone {
+	var matches []*Zone
+	for _, zone := range z.sortedZones {
+		if strings.HasSuffix(name, zone.Name+".") {
+			matches = append(matches, zone)
+		}
+	}
+	return matches
 }
 
 // AddZone adds a new Zone to Zones.
@@ -58,13 +128,46 @@ func (z *Zones) AddZone(zone *Zone) {
 
 // NewZone creates a new Zone in Zones using the settings in the
 // provided ConfigZone.  The resulting Zone is added to Zones
-// automatically.
+// automatically.  Zones in "full" mode start out with their apex NS
+// records, and zones with classless delegations start out with the
+// CNAMEs for them.  Invalid prefixes are ignored; they're reported
+// when the config is parsed.
 func (z *Zones) NewZone(cz *ConfigZone) {
 	zone := Zone{
 		Name:     cz.Name,
 		Filename: cz.Filename,
 		TTL:      cz.TTL,
 		Records:  []*Record{},
+		static:   cz.Records,
+	}
+	if cz.Prefix != "" {
+		zone.Prefix, _ = netip.ParsePrefix(cz.Prefix)
+		zone.Prefix = zone.Prefix.Masked()
+	} else {
+		zone.Prefix, _ = ReverseZonePrefix(cz.Name)
+	}
+	for _, d := range cz.ClasslessDelegations {
+		prefix, err := netip.ParsePrefix(d.Prefix)
+		if err != nil {
+			continue
+		}
+		child, err := ClasslessZoneName(prefix, d.Style)
+		if err != nil {
+			continue
+		}
+		zone.delegations = append(zone.delegations, prefix.Masked())
+		for _, r := range classlessCNAMEs(prefix, child, d.Nameservers) {
+			zone.AddRecord(r)
+		}
+	}
+	if cz.Mode == "full" {
+		for _, ns := range cz.Nameservers {
+			zone.AddRecord(&Record{
+				Name:    cz.Name + ".",
+				Type:    "NS",
+				Rrdatas: []string{absoluteName(ns, cz.Name)},
+			})
+		}
 	}
 	z.AddZone(&zone)
 }
@@ -88,6 +191,13 @@ type Zone struct {
 	Filename string
 	TTL      int64
 	Records  []*Record
+
+	// Prefix is the range of addresses covered by a reverse
+	// zone.  It's invalid for forward zones.
+	Prefix netip.Prefix
+
+	static      []*ConfigRecord // Static records from the config
+	delegations []netip.Prefix  // Classless zones delegated from this zone
 }
 
 // AddRecord adds a single record to this zone.  It does not check
@@ -99,6 +209,132 @@ func (z *Zone) AddRecord(r *Record) {
 	z.Records = append(z.Records, r)
 }
 
+// AddStaticRecords adds the zone's static records from the config.
+// Static records are added after the records from NetBox, and take
+// precedence over them: if a static CNAME uses a name that NetBox
+// also generated records for, the NetBox records are dropped and
+// returned as conflicts.
+func (z *Zone) AddStaticRecords() ([]Conflict, error) {
+	var static []*Record
+	cnames := map[string]*Record{}
+	for _, cr := range z.static {
+		r, err := StaticRecord(z.Name, cr)
+		if err != nil {
+			return nil, err
+		}
+		if r.Type == "CNAME" {
+			if r.Name == z.Name+"." {
+				return nil, fmt.Errorf("Static CNAME %q can't be at the apex of zone %q", cr.Name, z.Name)
+			}
+			cnames[strings.ToLower(r.Name)] = r
+		}
+		static = append(static, r)
+	}
+	for _, r := range static {
+		if c := cnames[strings.ToLower(r.Name)]; c != nil && c != r {
+			return nil, fmt.Errorf("Static CNAME for %q can't have other static records with the same name", r.Name)
+		}
+	}
+
+	var conflicts []Conflict
+	if len(cnames) > 0 {
+		dropped := map[string]*Conflict{}
+		var names []string
+		records := z.Records[:0]
+		for _, r := range z.Records {
+			name := strings.ToLower(r.Name)
+			c := cnames[name]
+			if c == nil {
+				records = append(records, r)
+				continue
+			}
+			if dropped[name] == nil {
+				dropped[name] = &Conflict{
+					Name:   c.Name,
+					Type:   "CNAME",
+					Values: []string{c.Rrdatas[0]},
+					Reason: "static CNAME replaces records from NetBox",
+				}
+				names = append(names, name)
+			}
+			for _, rd := range r.Rrdatas {
+				dropped[name].Values = append(dropped[name].Values, r.Type+" "+rd)
+			}
+		}
+		z.Records = records
+		sort.Strings(names)
+		for _, name := range names {
+			conflicts = append(conflicts, *dropped[name])
+		}
+	}
+
+	for _, r := range static {
+		z.AddRecord(r)
+	}
+	return conflicts, nil
+}
+
+// Conflict describes a name in a zone with records that can't be
+// published together, such as two different PTR records for the same
+// address.
+type Conflict struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Values []string `json:"values"`
+	Reason string   `json:"reason,omitempty"`
+}
+
+// singletonTypes lists record types that should only have a single
+// value per name.  Multiple PTR records are legal, but resolvers
+// return them in arbitrary order, so they're almost always a mistake
+// in NetBox, like the same address with different names in two VRFs.
+var singletonTypes = map[string]bool{
+	"PTR":   true,
+	"CNAME": true,
+}
+
+// Conflicts returns all conflicting names in this zone, sorted by name.
+func (z *Zone) Conflicts() []Conflict {
+	type key struct{ name, rtype string }
+	values := map[key][]string{}
+	var keys []key
+
+	for _, r := range z.Records {
+		if !singletonTypes[r.Type] {
+			continue
+		}
+		k := key{r.Name, r.Type}
+		if _, ok := values[k]; !ok {
+			keys = append(keys, k)
+		}
+		for _, rd := range r.Rrdatas {
+			if !containsString(values[k], rd) {
+				values[k] = append(values[k], rd)
+			}
+		}
+	}
+
+	var conflicts []Conflict
+	for _, k := range keys {
+		if len(values[k]) > 1 {
+			conflicts = append(conflicts, Conflict{Name: k.name, Type: k.rtype, Values: values[k]})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Name < conflicts[j].Name
+	})
+	return conflicts
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
 // ReverseName takes an IP address and returns the correct reverse DNS
 // name for that IP.  It maps IPv4 addresses into `in-addr.arpa` and
 // IPv6 addresses into `ip6.arpa`.
@@ -123,35 +359,93 @@ func reverseName6(addr netip.Addr) string {
 	return ret + "ip6.arpa."
 }
 
+// AddrStats describes what happened to the addresses passed to
+// AddAddrs.
+type AddrStats struct {
+	Added     int      // Addresses that produced at least one record
+	Skipped   int      // Addresses that aren't active or have no DNS name
+	Invalid   []string // DNS names that aren't valid hostnames
+	Unmatched []string // Record names that don't belong in any zone
+}
+
 // AddAddrs adds multiple addresses to a set of Zones.  This creates
-// both forward and reverse DNS entries.
-func (z *Zones) AddAddrs(addrs []netboxlib.IpamIPAddress) error {
+// both forward and reverse DNS entries.  Records that don't belong in
+// any zone are listed in the returned AddrStats rather than logged,
+// since whether they matter depends on which zones are being written.
+func (z *Zones) AddAddrs(addrs []netboxlib.IpamIPAddress) (*AddrStats, error) {
+	stats := &AddrStats{}
+
 	for _, addr := range addrs {
-		if addr.DNSName != "" && addr.Status == "active" {
-			forward := Record{
-				Name:    addr.DNSName + ".",
-				Rrdatas: []string{addr.Address.String()},
-			}
-			reverse := Record{
-				Name:    ReverseName(addr.Address),
-				Type:    "PTR",
-				Rrdatas: []string{addr.DNSName + "."},
-			}
-			if addr.Address.Is4() {
-				forward.Type = "A"
+		if reason, invalid := addrSkipReason(addr); reason != "" {
+			if invalid {
+				log.Warningf("Skipping %s: %s", addr.Address, reason)
+				stats.Invalid = append(stats.Invalid, addr.DNSName)
 			} else {
-				forward.Type = "AAAA"
+				stats.Skipped++
 			}
+			continue
+		}
 
-			err := z.AddRecord(&forward)
-			if err != nil {
-				log.Warningf("Unable to add forward record: %v", err)
-			}
-			err = z.AddRecord(&reverse)
-			if err != nil {
-				log.Warningf("Unable to add reverse record: %v", err)
-			}
+		forward, reverse := addrRecords(addr)
+
+		added := false
+		err := z.AddRecord(forward)
+		if err != nil {
+			log.V(1).Infof("Unable to add forward record: %v", err)
+			stats.Unmatched = append(stats.Unmatched, forward.Name)
+		} else {
+			added = true
+		}
+		err = z.AddRecord(reverse)
+		if err != nil {
+			log.V(1).Infof("Unable to add reverse record: %v", err)
+			stats.Unmatched = append(stats.Unmatched, reverse.Name)
+		} else {
+			added = true
+		}
+		if added {
+			stats.Added++
 		}
 	}
-	return nil
+	return stats, nil
+}
+
+// addrSkipReason returns a description of why addr shouldn't produce
+// any DNS records, or "" if it should.  `invalid` is true if addr
+// was skipped because its DNS name is invalid, as opposed to being
+// intentionally left out of DNS.
+func addrSkipReason(addr netboxlib.IpamIPAddress) (reason string, invalid bool) {
+	switch {
+	case addr.DNSName == "":
+		return "no DNS name", false
+	case containsString(addr.Tags, netboxlib.ExcludeTag):
+		return fmt.Sprintf("tagged %s", netboxlib.ExcludeTag), false
+	case addr.Status != "active":
+		return fmt.Sprintf("status is %q, not \"active\"", addr.Status), false
+	case !ValidHostname(addr.DNSName):
+		return fmt.Sprintf("invalid DNS name %q", addr.DNSName), true
+	}
+	return "", false
+}
+
+// addrRecords returns the forward and reverse records for addr.
+func addrRecords(addr netboxlib.IpamIPAddress) (forward, reverse *Record) {
+	forward = &Record{
+		Name:    addr.DNSName + ".",
+		Rrdatas: []string{addr.Address.String()},
+		Source:  &addr,
+	}
+	reverse = &Record{
+		Name:    ReverseName(addr.Address),
+		Type:    "PTR",
+		Rrdatas: []string{addr.DNSName + "."},
+		Addr:    addr.Address,
+		Source:  &addr,
+	}
+	if addr.Address.Is4() {
+		forward.Type = "A"
+	} else {
+		forward.Type = "AAAA"
+	}
+	return forward, reverse
 }
@@ -2,7 +2,11 @@ package netbox2dns
 
 import (
 	"net/netip"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/scottlaird/netbox2dns/netboxlib"
 )
 
 func TestAddZonesSorted(t *testing.T) {
@@ -82,3 +86,254 @@ func TestReverseName6(t *testing.T) {
 		t.Errorf("ReverseName(%s) wrong, got %q want %q", addr.String(), got, want)
 	}
 }
+
+func TestAddAddrs(t *testing.T) {
+	z := NewZones()
+	z.NewZone(&ConfigZone{Name: "example.com", TTL: 300})
+	z.NewZone(&ConfigZone{Name: "10.in-addr.arpa", TTL: 300})
+
+	addrs := []netboxlib.IpamIPAddress{
+		{Address: netip.MustParseAddr("10.0.0.1"), DNSName: "a.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("10.0.0.2"), DNSName: "b.example.com", Status: "deprecated"},
+		{Address: netip.MustParseAddr("10.0.0.3"), DNSName: "", Status: "active"},
+		{Address: netip.MustParseAddr("10.0.0.4"), DNSName: "bad name.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("192.0.2.1"), DNSName: "c.example.org", Status: "active"},
+	}
+
+	stats, err := z.AddAddrs(addrs)
+	if err != nil {
+		t.Fatalf("AddAddrs() returned an error: %v", err)
+	}
+
+	if stats.Added != 1 {
+		t.Errorf("stats.Added: got %d, want 1", stats.Added)
+	}
+	if stats.Skipped != 2 {
+		t.Errorf("stats.Skipped: got %d, want 2", stats.Skipped)
+	}
+	if len(stats.Invalid) != 1 || stats.Invalid[0] != "bad name.example.com" {
+		t.Errorf("stats.Invalid: got %v, want [bad name.example.com]", stats.Invalid)
+	}
+	if len(stats.Unmatched) != 2 {
+		t.Errorf("stats.Unmatched: got %v, want 2 names", stats.Unmatched)
+	}
+
+	if got := len(z.Zones["example.com"].Records); got != 1 {
+		t.Errorf("len(example.com records): got %d, want 1", got)
+	}
+	if got := len(z.Zones["10.in-addr.arpa"].Records); got != 1 {
+		t.Errorf("len(10.in-addr.arpa records): got %d, want 1", got)
+	}
+}
+
+func TestValidHostname(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"host.example.com", true},
+		{"host.example.com.", true},
+		{"_sip._tcp.example.com", true},
+		{"*.example.com", true},
+		{"a.*.example.com", false},
+		{"", false},
+		{"-host.example.com", false},
+		{"host-.example.com", false},
+		{"bad name.example.com", false},
+		{"host..example.com", false},
+		{strings.Repeat("a", 64) + ".example.com", false},
+	}
+
+	for _, test := range tests {
+		if got := ValidHostname(test.name); got != test.want {
+			t.Errorf("ValidHostname(%q): got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	z := NewZones()
+	z.NewZone(&ConfigZone{Name: "10.in-addr.arpa", TTL: 300})
+
+	addrs := []netboxlib.IpamIPAddress{
+		{Address: netip.MustParseAddr("10.0.0.1"), DNSName: "a.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("10.0.0.1"), DNSName: "b.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("10.0.0.2"), DNSName: "c.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("10.0.0.2"), DNSName: "c.example.com", Status: "active"},
+	}
+	_, err := z.AddAddrs(addrs)
+	if err != nil {
+		t.Fatalf("AddAddrs() returned an error: %v", err)
+	}
+
+	conflicts := z.Zones["10.in-addr.arpa"].Conflicts()
+	if len(conflicts) != 1 {
+		t.Fatalf("Conflicts(): got %v, want 1 conflict", conflicts)
+	}
+	c := conflicts[0]
+	if c.Name != "1.0.0.10.in-addr.arpa." || c.Type != "PTR" || len(c.Values) != 2 {
+		t.Errorf("Conflicts()[0]: got %+v, want 2 PTRs for 1.0.0.10.in-addr.arpa.", c)
+	}
+}
+
+func TestStaticRecord(t *testing.T) {
+	tests := []struct {
+		cr   ConfigRecord
+		want string
+	}{
+		{ConfigRecord{Name: "@", Type: "MX", Preference: 10, Target: "mail"}, "example.com. MX 10 mail.example.com."},
+		{ConfigRecord{Name: "www", Type: "CNAME", Target: "web.example.net."}, "www.example.com. CNAME web.example.net."},
+		{ConfigRecord{Name: "_sip._tcp", Type: "SRV", Priority: 10, Weight: 5, Port: 5060, Target: "sip"}, "_sip._tcp.example.com. SRV 10 5 5060 sip.example.com."},
+		{ConfigRecord{Name: "lab.example.com.", Type: "NS", Target: "ns1.lab"}, "lab.example.com. NS ns1.lab.example.com."},
+		{ConfigRecord{Name: "@", Type: "TXT", Text: `say "hi"`}, `example.com. TXT "say \"hi\""`},
+		{ConfigRecord{Name: "@", Type: "CAA", Tag: "issue", Value: "letsencrypt.org"}, `example.com. CAA 0 issue "letsencrypt.org"`},
+		{ConfigRecord{Name: "_srv", Type: "SRV", Target: "."}, "_srv.example.com. SRV 0 0 0 ."},
+	}
+
+	for _, test := range tests {
+		r, err := StaticRecord("example.com", &test.cr)
+		if err != nil {
+			t.Errorf("StaticRecord(%+v) returned an error: %v", test.cr, err)
+			continue
+		}
+		got := r.Name + " " + r.Type + " " + strings.Join(r.Rrdatas, " ")
+		if got != test.want {
+			t.Errorf("StaticRecord(%+v): got %q, want %q", test.cr, got, test.want)
+		}
+	}
+
+	long := strings.Repeat("a", 300)
+	r, err := StaticRecord("example.com", &ConfigRecord{Name: "@", Type: "TXT", Text: long})
+	if err != nil {
+		t.Fatalf("StaticRecord(long TXT) returned an error: %v", err)
+	}
+	if want := `"` + long[:255] + `" "` + long[255:] + `"`; r.Rrdatas[0] != want {
+		t.Errorf("StaticRecord(long TXT): got %q, want two strings", r.Rrdatas[0])
+	}
+
+	if _, err := StaticRecord("example.com", &ConfigRecord{Name: "www.example.org.", Type: "CNAME", Target: "x"}); err == nil {
+		t.Errorf("StaticRecord() outside the zone succeeded, want error")
+	}
+}
+
+func TestAddStaticRecords(t *testing.T) {
+	z := NewZones()
+	z.NewZone(&ConfigZone{Name: "example.com", TTL: 300, Records: []*ConfigRecord{
+		{Name: "www", Type: "CNAME", Target: "web.example.net.", TTL: 3600},
+		{Name: "@", Type: "MX", Preference: 10, Target: "mail"},
+	}})
+
+	addrs := []netboxlib.IpamIPAddress{
+		{Address: netip.MustParseAddr("10.0.0.1"), DNSName: "www.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("2001:db8::1"), DNSName: "www.example.com", Status: "active"},
+		{Address: netip.MustParseAddr("10.0.0.2"), DNSName: "mail.example.com", Status: "active"},
+	}
+	if _, err := z.AddAddrs(addrs); err != nil {
+		t.Fatalf("AddAddrs() returned an error: %v", err)
+	}
+
+	zone := z.Zones["example.com"]
+	conflicts, err := zone.AddStaticRecords()
+	if err != nil {
+		t.Fatalf("AddStaticRecords() returned an error: %v", err)
+	}
+	if len(conflicts) != 1 {
+		t.Fatalf("AddStaticRecords(): got conflicts %v, want 1", conflicts)
+	}
+	want := []string{"web.example.net.", "A 10.0.0.1", "AAAA 2001:db8::1"}
+	if c := conflicts[0]; c.Name != "www.example.com." || c.Type != "CNAME" || !reflect.DeepEqual(c.Values, want) {
+		t.Errorf("AddStaticRecords() conflict: got %+v, want CNAME for www.example.com. with values %v", c, want)
+	}
+
+	got := map[string]int64{}
+	for _, r := range zone.Records {
+		got[r.Name+" "+r.Type] = r.TTL
+	}
+	wantRecords := map[string]int64{
+		"mail.example.com. A":    300,
+		"www.example.com. CNAME": 3600,
+		"example.com. MX":        300,
+	}
+	if !reflect.DeepEqual(got, wantRecords) {
+		t.Errorf("Records after AddStaticRecords(): got %v, want %v", got, wantRecords)
+	}
+
+	bad := &Zone{Name: "example.com", static: []*ConfigRecord{
+		{Name: "www", Type: "CNAME", Target: "a"},
+		{Name: "www", Type: "TXT", Text: "b"},
+	}}
+	if _, err := bad.AddStaticRecords(); err == nil {
+		t.Errorf("AddStaticRecords() with a CNAME and TXT at one name succeeded, want error")
+	}
+}
+
+func TestMailboxName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"hostmaster@example.com", "hostmaster.example.com."},
+		{"first.last@example.com.", `first\.last.example.com.`},
+		{"hostmaster.example.net.", "hostmaster.example.net."},
+		{"hostmaster", "hostmaster.example.com."},
+	}
+	for _, test := range tests {
+		if got := MailboxName(test.in, "example.com"); got != test.want {
+			t.Errorf("MailboxName(%q): got %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestNewZoneFull(t *testing.T) {
+	z := NewZones()
+	z.NewZone(&ConfigZone{Name: "example.com", TTL: 300, Mode: "full", Nameservers: []string{"ns1", "ns2.example.net."}})
+	z.NewZone(&ConfigZone{Name: "example.org", TTL: 300, Mode: "include", Nameservers: []string{"ns1"}})
+
+	var got []string
+	for _, r := range z.Zones["example.com"].Records {
+		got = append(got, r.Name+" "+r.Type+" "+r.Rrdatas[0])
+	}
+	want := []string{"example.com. NS ns1.example.com.", "example.com. NS ns2.example.net."}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("full zone records: got %v, want %v", got, want)
+	}
+	if n := len(z.Zones["example.org"].Records); n != 0 {
+		t.Errorf("include zone has %d records, want 0", n)
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	tests := []struct {
+		addr netboxlib.IpamIPAddress
+		want string
+	}{
+		{
+			addr: netboxlib.IpamIPAddress{ID: 1234},
+			want: "netbox ipam/ip-addresses/1234",
+		},
+		{
+			addr: netboxlib.IpamIPAddress{ID: 1234, VRF: "prod"},
+			want: "netbox ipam/ip-addresses/1234 vrf=prod",
+		},
+		{
+			addr: netboxlib.IpamIPAddress{ID: 7, VRF: "Lab Network", Tenant: "acme"},
+			want: `netbox ipam/ip-addresses/7 vrf="Lab Network" tenant=acme`,
+		},
+	}
+
+	for _, test := range tests {
+		test.addr.Address = netip.MustParseAddr("10.0.0.1")
+		test.addr.DNSName = "a.example.com"
+		forward, reverse := addrRecords(test.addr)
+		if got := forward.Provenance(); got != test.want {
+			t.Errorf("forward.Provenance() for %+v: got %q, want %q", test.addr, got, test.want)
+		}
+		if got := reverse.Provenance(); got != test.want {
+			t.Errorf("reverse.Provenance() for %+v: got %q, want %q", test.addr, got, test.want)
+		}
+	}
+
+	r := &Record{Name: "www.example.com.", Type: "CNAME", Rrdatas: []string{"a.example.com."}}
+	if got := r.Provenance(); got != "" {
+		t.Errorf("Provenance() of a static record: got %q, want \"\"", got)
+	}
+}